@@ -0,0 +1,97 @@
+package calibrate
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/spf13/cobra"
+)
+
+var (
+	duration = 10 * time.Second
+	interval = 20 * time.Millisecond
+)
+
+func init() {
+	Command.Flags().DurationVarP(&duration, "duration", "d", duration, "Time to measure position reports")
+	Command.Flags().DurationVarP(&interval, "interval", "i", interval, "Time between position queries")
+}
+
+// Command is the player latency calibration command
+var Command = &cobra.Command{
+	Use: "calibrate",
+	Example: `  waybar-lyric calibrate # Measure position reports of the current player for 10 seconds
+  waybar-lyric calibrate --duration 30s # Measure position reports for 30 seconds`,
+	Short: "Suggest position corrections for current player",
+	Args:  cobra.NoArgs,
+
+	RunE: func(_ *cobra.Command, _ []string) error {
+		if interval <= 0 || duration < 10*interval {
+			return errors.New("duration must be at least 10 times the interval")
+		}
+
+		conn, err := bus.Session()
+		if err != nil {
+			return fmt.Errorf("failed to create dbus connection: %w", err)
+		}
+		slog.Debug("Created dbus session bus")
+
+		mp, parser, err := player.Select(conn)
+		if err != nil {
+			return fmt.Errorf("failed to select player: %w", err)
+		}
+		slog.Debug("Selected player", "player", mp.GetName())
+
+		info, err := parser(mp)
+		if err != nil {
+			return fmt.Errorf("failed to parse player informations: %w", err)
+		}
+		if info.Status != mpris.PlaybackPlaying {
+			return errors.New("player must be playing while calibrating")
+		}
+
+		slog.Info("Measuring position reports", "player", mp.GetName(), "duration", duration)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		var samples []player.Sample
+		for end := time.Now().Add(duration); time.Now().Before(end); <-ticker.C {
+			pos, err := mp.GetPosition()
+			if err != nil {
+				return fmt.Errorf("failed to get player position: %w", err)
+			}
+			samples = append(samples, player.Sample{At: time.Now(), Position: pos})
+		}
+
+		c, err := player.Calibrate(samples)
+		if err != nil {
+			return err
+		}
+
+		name := player.LatencyPattern(info)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(w, "Player:\t%s\n", name)
+		fmt.Fprintf(w, "Samples:\t%d\n", len(samples))
+		fmt.Fprintf(w, "Update interval:\t%s\n", c.Interval.Round(time.Millisecond))
+		fmt.Fprintf(w, "Position step:\t%s\n", c.Step.Round(time.Millisecond))
+		switch {
+		case c.Latency.Coarse:
+			fmt.Fprintf(w, "Suggestion:\t--coarse-position %s\n", name)
+		case c.Latency.Offset != 0:
+			fmt.Fprintf(w, "Suggestion:\t--player-offset %s=%s\n", name, c.Latency.Offset)
+		default:
+			fmt.Fprintf(w, "Suggestion:\tno correction needed\n")
+		}
+
+		return w.Flush()
+	},
+}
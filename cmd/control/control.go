@@ -0,0 +1,166 @@
+package control
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/carapace-sh/carapace"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	Command.AddCommand(nextCommand)
+	Command.AddCommand(previousCommand)
+	Command.AddCommand(stopCommand)
+	Command.AddCommand(shuffleCommand)
+	Command.AddCommand(loopCommand)
+
+	carapace.Gen(shuffleCommand).PositionalCompletion(carapace.ActionValues("on", "off", "toggle"))
+	carapace.Gen(loopCommand).PositionalCompletion(carapace.ActionValues("none", "track", "playlist"))
+}
+
+// Command is the player control command
+var Command = &cobra.Command{
+	Use: "control",
+	Example: `  waybar-lyric control next # Skip to next track
+  waybar-lyric control shuffle toggle # Toggle shuffle
+  waybar-lyric control loop track # Repeat current track`,
+	Short: "Control player playback",
+}
+
+// selectPlayer selects the player to control and checks if it supports the
+// capability
+func selectPlayer(capability string) (*mpris.Player, error) {
+	conn, err := bus.Session()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dbus connection: %w", err)
+	}
+	slog.Debug("Created dbus session bus")
+
+	mp, _, err := player.Select(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select player: %w", err)
+	}
+	slog.Debug("Selected player", "player", mp.GetName())
+
+	if err := player.Can(conn, mp, capability); err != nil {
+		return nil, err
+	}
+	return mp, nil
+}
+
+var nextCommand = &cobra.Command{
+	Use:   "next",
+	Short: "Skip to next track",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		mp, err := selectPlayer("CanGoNext")
+		if err != nil {
+			return err
+		}
+		slog.Info("Skipping to next track")
+		if err := mp.Next(); err != nil {
+			return fmt.Errorf("failed to skip to next track: %w", err)
+		}
+		return nil
+	},
+}
+
+var previousCommand = &cobra.Command{
+	Use:   "previous",
+	Short: "Skip to previous track",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		mp, err := selectPlayer("CanGoPrevious")
+		if err != nil {
+			return err
+		}
+		slog.Info("Skipping to previous track")
+		if err := mp.Previous(); err != nil {
+			return fmt.Errorf("failed to skip to previous track: %w", err)
+		}
+		return nil
+	},
+}
+
+var stopCommand = &cobra.Command{
+	Use:   "stop",
+	Short: "Stop playback",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		mp, err := selectPlayer("CanControl")
+		if err != nil {
+			return err
+		}
+		slog.Info("Stopping playback")
+		if err := mp.Stop(); err != nil {
+			return fmt.Errorf("failed to stop playback: %w", err)
+		}
+		return nil
+	},
+}
+
+var shuffleCommand = &cobra.Command{
+	Use:       "shuffle on|off|toggle",
+	Short:     "Set shuffle mode",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"on", "off", "toggle"},
+
+	DisableFlagsInUseLine: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		mp, err := selectPlayer("CanControl")
+		if err != nil {
+			return err
+		}
+
+		shuffle := args[0] == "on"
+		if args[0] == "toggle" {
+			current, err := mp.GetShuffle()
+			if player.IsMissingProperty(err) {
+				return fmt.Errorf("failed to get shuffle: %w: %w", player.ErrUnsupported, err)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get shuffle: %w", err)
+			}
+			shuffle = !current
+		}
+
+		slog.Info("Setting shuffle", "shuffle", shuffle)
+		if err := mp.SetShuffle(shuffle); err != nil {
+			return fmt.Errorf("failed to set shuffle: %w", err)
+		}
+		return nil
+	},
+}
+
+// loopStatuses maps loop arguments to mpris loop status
+var loopStatuses = map[string]mpris.LoopStatus{
+	"none":     mpris.LoopNone,
+	"track":    mpris.LoopTrack,
+	"playlist": mpris.LoopPlaylist,
+}
+
+var loopCommand = &cobra.Command{
+	Use:       "loop none|track|playlist",
+	Short:     "Set loop mode",
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs: []string{"none", "track", "playlist"},
+
+	DisableFlagsInUseLine: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		mp, err := selectPlayer("CanControl")
+		if err != nil {
+			return err
+		}
+
+		status := loopStatuses[args[0]]
+		slog.Info("Setting loop status", "status", status)
+		if err := mp.SetLoopStatus(status); err != nil {
+			return fmt.Errorf("failed to set loop status: %w", err)
+		}
+		return nil
+	},
+}
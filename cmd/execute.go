@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -10,16 +11,29 @@ import (
 	"time"
 
 	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
 	"github.com/Nadim147c/waybar-lyric/internal/config"
+	"github.com/Nadim147c/waybar-lyric/internal/loop"
 	"github.com/Nadim147c/waybar-lyric/internal/lyric"
 	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/record"
+	"github.com/Nadim147c/waybar-lyric/internal/simulate"
+	"github.com/Nadim147c/waybar-lyric/internal/sink"
+	"github.com/Nadim147c/waybar-lyric/internal/sleep"
+	"github.com/Nadim147c/waybar-lyric/internal/state"
 	"github.com/Nadim147c/waybar-lyric/internal/waybar"
 	"github.com/godbus/dbus/v5"
+	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
 )
 
-// SleepTime is the time for main fixed loop
-const SleepTime = 500 * time.Millisecond
+// DriftInterval is the time between checks of extrapolated position against
+// the player position
+const DriftInterval = 5 * time.Second
+
+// RestartThreshold is how far position must jump backward without a Seeked
+// signal to be treated as a restarted track
+const RestartThreshold = 2 * time.Second
 
 // Execute is the main function for lyrics
 func Execute(cmd *cobra.Command, _ []string) error {
@@ -32,29 +46,9 @@ func Execute(cmd *cobra.Command, _ []string) error {
 		return nil
 	}
 
-	conn, err := dbus.SessionBus()
-	if err != nil {
-		slog.Error("Failed to create dbus connection", "error", err)
-		return nil
-	}
-
-	var mprisPlayer *mpris.Player
-	for mprisPlayer == nil {
-		p, _, err := player.Select(conn)
-		if err != nil {
-			slog.Debug("Failed to select player", "error", err)
-			time.Sleep(SleepTime)
-		}
-		mprisPlayer = p
-	}
-	slog.Debug("Player selected", "player", mprisPlayer)
-
 	ctx, cancel := context.WithCancel(cmd.Context())
 	defer cancel()
 
-	// Clean In memery lyrics cache every 10 minute
-	go lyric.Store.Cleanup(ctx, 10*time.Minute)
-
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
@@ -62,64 +56,323 @@ func Execute(cmd *cobra.Command, _ []string) error {
 		cancel()
 	}()
 
-	playerSignal := make(chan *dbus.Signal)
-	mprisPlayer.OnSignal(playerSignal)
+	if config.RecordPath != "" {
+		stop, err := record.Start(config.RecordPath)
+		if err != nil {
+			return fmt.Errorf("failed to start recording: %w", err)
+		}
+		defer func() {
+			if err := stop(); err != nil {
+				slog.Error("Failed to close recording", "error", err)
+			}
+		}()
+	}
+
+	if config.Simulate != "" {
+		return simulateLyrics(ctx)
+	}
+	if cmd.Flags().Changed("speed") || cmd.Flags().Changed("pause-at") {
+		return errors.New("--speed and --pause-at require --simulate")
+	}
+
+	// Clean In memery lyrics cache every 10 minute
+	go lyric.Store.Cleanup(ctx, 10*time.Minute)
+
+	if config.RevalidateDays > 0 {
+		go lyric.Revalidate(ctx, time.Duration(config.RevalidateDays)*24*time.Hour)
+	}
+
+	// Position offset depends on the audio sink
+	sinkChanges := sink.Watch(ctx)
+
+	var disconnected bool
+	for {
+		conn, err := bus.Connect(ctx, func(err error, wait time.Duration) {
+			slog.Error("Failed to connect to dbus session bus", "error", err, "retry-in", wait)
+			if !disconnected {
+				record.Wake("disconnected")
+				waybar.DisconnectedWaybar.Encode()
+				disconnected = true
+			}
+		})
+		if err != nil {
+			return err
+		}
+		slog.Debug("Connected to dbus session bus")
+		disconnected = false
+
+		err = run(ctx, conn, sinkChanges)
+		if !errors.Is(err, bus.ErrDisconnected) {
+			return err
+		}
+
+		slog.Error("Lost dbus session bus connection, reconnecting")
+		record.Wake("disconnected")
+		waybar.DisconnectedWaybar.Encode()
+		disconnected = true
+	}
+}
+
+// simulateLyrics prints output for the --simulate LRC file on a virtual clock
+// without connecting to dbus
+func simulateLyrics(ctx context.Context) error {
+	speed, err := simulate.ParseSpeed(config.SimulateSpeed)
+	if err != nil {
+		return err
+	}
+
+	s, err := simulate.New(config.Simulate, config.SimulatePauseAt)
+	if err != nil {
+		return fmt.Errorf("failed to load simulation: %w", err)
+	}
+	record.Wake("simulate")
+	return simulate.Run(ctx, s, speed)
+}
+
+// run shows lyrics of players on the connection until ctx is done or the
+// connection is closed
+func run(ctx context.Context, conn *dbus.Conn, sinkChanges <-chan sink.Sink) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	lyricTicker := time.NewTicker(SleepTime)
-	defer lyricTicker.Stop()
+	// Follow the player which started playing most recently
+	playerSignal, err := player.Watch(ctx, conn)
+	if err != nil {
+		if !conn.Connected() {
+			return bus.ErrDisconnected
+		}
+		return fmt.Errorf("failed to watch players: %w", err)
+	}
 
-	// Main loop
-	fixedTicker := time.NewTicker(SleepTime)
-	defer fixedTicker.Stop()
+	// Main loop is driven by player signals. Position is extrapolated from
+	// the last query and checked against the player every DriftInterval.
+	lyricTimer := time.NewTimer(0)
+	defer lyricTimer.Stop()
 
-	var lastWaybar *waybar.Waybar
+	driftTicker := time.NewTicker(DriftInterval)
+	defer driftTicker.Stop()
 
-	instant := make(chan bool)
-	go func() { instant <- true }()
+	// Sleep timer, loop and lyrics offset are set by the sleep, loop and
+	// offset commands. Countdown is updated every second while the sleep
+	// timer is set.
+	stateChanges := state.Watch(ctx, sleep.State, loop.State, lyric.OffsetState)
+	sleepTicker := time.NewTicker(time.Second)
+	defer sleepTicker.Stop()
 
+	timer := loadSleepTimer()
+	if timer == nil {
+		sleepTicker.Stop()
+	}
+	var stopPause context.CancelFunc // cancels pausing by the sleep timer
+
+	repeat := loadLoop()
+
+	var (
+		lastWaybar  *waybar.Waybar
+		mprisPlayer *mpris.Player
+		parser      player.Parser
+		info        *player.Info
+		clock       player.Clock
+		owner       string // unique name of the selected player
+	)
+
+	zero := func() {
+		info = nil
+		record.Follow(nil)
+		w := waybar.Zero
+		if !w.Is(lastWaybar) {
+			w.Encode()
+			lastWaybar = w
+		}
+	}
+
+	refresh := true
 	for {
+		check := false
+		var reason string // why the loop woke up, for --record
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-playerSignal:
-			slog.Debug("Received player update signal")
-		case <-instant:
-		case <-lyricTicker.C:
-		case <-fixedTicker.C:
+		case <-conn.Context().Done():
+			return bus.ErrDisconnected
+		case sig := <-playerSignal:
+			reason = "player-signal"
+			if pos, ok := player.Seeked(sig); ok && sig.Sender == owner && info != nil {
+				reason = "seeked"
+				slog.Debug("Player seeked", "position", pos.String())
+				info.SetPosition(pos)
+				clock.Seek(info.Position, time.Now())
+				break
+			}
+			if player.OwnerChanged(sig) {
+				reason = "owner-changed"
+				refresh = true
+				break
+			}
+			props, ok := player.Changed(sig)
+			if !ok {
+				break
+			}
+			reason = "properties-changed"
+			// Rate changes don't need metadata to be parsed again
+			if v, ok := props["Rate"]; ok && len(props) == 1 && sig.Sender == owner && info != nil {
+				if rate := cast.ToFloat64(v.Value()); rate > 0 {
+					slog.Debug("Playback rate changed", "rate", rate)
+					info.Rate = rate
+					clock.SetRate(rate, time.Now())
+					break
+				}
+			}
+			// Other players only matter when they start or stop playing
+			if _, status := props["PlaybackStatus"]; sig.Sender == owner || status {
+				slog.Debug("Received player update signal", "sender", sig.Sender)
+				refresh = true
+			}
+		case <-sinkChanges:
+			reason = "sink-changed"
+			refresh = true
+		case name := <-stateChanges:
+			reason = name + "-changed"
+			if name == lyric.OffsetState {
+				// Lyrics are shifted by the new offset below
+				if info != nil {
+					lyric.ReloadOffset(info)
+				}
+				break
+			}
+			if name == loop.State {
+				repeat = loadLoop()
+				break
+			}
+			old := timer
+			timer = loadSleepTimer()
+			if timer == nil {
+				sleepTicker.Stop()
+			} else {
+				sleepTicker.Reset(time.Second)
+			}
+			if stopPause != nil && (timer == nil || !timer.Set.Equal(old.Set)) {
+				stopPause()
+				stopPause = nil
+			}
+		case <-sleepTicker.C:
+			reason = "sleep-tick"
+		case <-lyricTimer.C:
+			reason = "lyric-timer"
+			check = info != nil && (clock.Ended(time.Now()) || !clock.Settled())
+		case <-driftTicker.C:
+			reason = "drift-check"
+			check = info != nil
 		}
+		record.Wake(reason)
 
-		mprisPlayer, parser, err := player.Select(conn)
-		if err != nil {
-			slog.Error("Player not found!", "error", err)
+		if refresh {
+			refresh = false
 
-			w := waybar.Zero
-			if !w.Is(lastWaybar) {
-				w.Encode()
-				lastWaybar = w
+			var err error
+			mprisPlayer, parser, err = player.Select(conn)
+			if err != nil {
+				slog.Error("Player not found!", "error", err)
+				zero()
+				continue
+			}
+
+			owner, err = player.Owner(conn, mprisPlayer.GetName())
+			if err != nil {
+				slog.Warn("Failed to get player name owner", "error", err)
+			}
+
+			last := info
+			info, err = parser(mprisPlayer)
+			record.Follow(info)
+			if err != nil {
+				slog.Error("Failed to parse dbus mpris metadata", "error", err)
+				zero()
+				continue
+			}
+			clock.Sync(info, time.Now())
+			if last == nil || last.ID != info.ID {
+				// Offset may have been changed while another track played
+				lyric.ReloadOffset(info)
 			}
 
+			slog.Debug("PlayerInfo",
+				"id", info.ID,
+				"title", info.Title,
+				"artist", info.Artist,
+				"album", info.Album,
+				"position", info.Position.String(),
+				"length", info.Length.String(),
+			)
+		} else if check {
+			expected := clock.Position(time.Now())
+			pos, err := mprisPlayer.GetPosition()
+			if err != nil {
+				slog.Warn("Failed to get player position", "error", err)
+				refresh = true
+				continue
+			}
+			now := time.Now()
+			info.SetPosition(pos)
+
+			drift := info.Position - expected
+			if drift < -RestartThreshold {
+				// Players don't send signals when a track repeats
+				slog.Info("Position jumped backward, track restarted", "drift", drift.String())
+				refresh = true
+			} else {
+				slog.Debug("Position drift", "drift", drift.String())
+			}
+			clock.Observe(info.Position, now)
+		}
+
+		if info == nil {
 			continue
 		}
 
-		info, err := parser(mprisPlayer)
-		if err != nil {
-			slog.Error("Failed to parse dbus mpris metadata", "error", err)
-			w := waybar.Zero
-			if !w.Is(lastWaybar) {
-				w.Encode()
-				lastWaybar = w
+		sleepLeft := time.Duration(-1)
+		if timer != nil {
+			now := time.Now()
+			if timer.Advance(info.ID) {
+				if err := timer.Save(); err != nil {
+					slog.Warn("Failed to update sleep timer", "error", err)
+				}
+			}
+			deadline := timer.Deadline(clock.RealTime(info.Length-clock.Position(now)), now)
+			if !deadline.IsZero() {
+				sleepLeft = max(deadline.Sub(now), 0)
+			}
+
+			// Track timers wait while the player is paused
+			waiting := timer.Until.IsZero() && info.Status != mpris.PlaybackPlaying
+			if stopPause == nil && sleepLeft >= 0 && sleepLeft <= timer.Fade && !waiting {
+				slog.Info("Sleep timer ended, pausing player", "fade", sleepLeft.String())
+				stopPause = pauseAsleep(ctx, mprisPlayer, sleepLeft)
 			}
-			continue
 		}
 
-		slog.Debug("PlayerInfo",
-			"id", info.ID,
-			"title", info.Title,
-			"artist", info.Artist,
-			"album", info.Album,
-			"position", info.Position.String(),
-			"length", info.Length.String(),
-		)
+		// loopIn is the time until position passes the end of the loop
+		var loopIn time.Duration
+		if repeat != nil && repeat.Track != info.ID {
+			slog.Info("Track changed, cancelling loop")
+			if err := loop.Cancel(); err != nil {
+				slog.Error("Failed to cancel loop", "error", err)
+			}
+			repeat = nil
+		}
+		if repeat != nil && info.Status == mpris.PlaybackPlaying {
+			now := time.Now()
+			if clock.Position(now) >= repeat.To {
+				slog.Info("Loop ended, seeking to start", "from", repeat.From.String())
+				// Loop positions are corrected by the latency of the player
+				if err := mprisPlayer.SetPosition(info.PlayerPosition(repeat.From)); err != nil {
+					slog.Error("Failed to seek to start of loop", "error", err)
+				}
+				info.Position = repeat.From
+				clock.Seek(info.Position, now)
+			}
+			loopIn = max(clock.RealTime(repeat.To-clock.Position(now)), time.Millisecond)
+		}
 
 		if info.Status == mpris.PlaybackStopped {
 			slog.Info("Player is stopped")
@@ -136,38 +389,32 @@ func Execute(cmd *cobra.Command, _ []string) error {
 			slog.Error("Failed to get lyrics", "error", err)
 			w := waybar.ForPlayer(info)
 			w.Alt = waybar.NoLyric
+			if timer != nil {
+				w.SleepTimer(timer.Tracks, sleepLeft)
+			}
 			if !w.Is(lastWaybar) {
 				w.Encode()
 				lastWaybar = w
 			}
+			if loopIn > 0 {
+				lyricTimer.Reset(loopIn)
+			}
 
 			continue
 		}
 
-		err = info.UpdatePosition(mprisPlayer)
-		if err != nil {
-			slog.Error("Failed to update position", "error", err)
-			continue
-		}
-
-		var idx int
-		for i, line := range lyrics {
-			if info.Position <= line.Timestamp {
-				break
-			}
-			idx = i
-		}
+		now := time.Now()
+		info.Position = clock.Position(now)
 
+		w, idx := waybar.ForPosition(info, lyrics)
 		currentLyric := lyrics[idx]
 
-		w := waybar.ForLyrics(lyrics, idx)
-		if config.Detailed {
-			w.Info = info
+		if timer != nil {
+			w.SleepTimer(timer.Tracks, sleepLeft)
 		}
-		w.Percentage = info.Percentage()
 
 		if info.Status == mpris.PlaybackPaused {
-			w.Paused(info)
+			lyricTimer.Stop()
 			if !w.Is(lastWaybar) {
 				slog.Info("Lyrics",
 					"line", currentLyric.Text,
@@ -180,11 +427,6 @@ func Execute(cmd *cobra.Command, _ []string) error {
 			continue
 		}
 
-		if currentLyric.Text == "" {
-			w.Text = fmt.Sprintf("%s - %s", info.Artist, info.Title)
-			w.Alt = waybar.Music
-		}
-
 		if !w.Is(lastWaybar) {
 			slog.Info("Lyrics",
 				"line", currentLyric.Text,
@@ -195,23 +437,70 @@ func Execute(cmd *cobra.Command, _ []string) error {
 			lastWaybar = w
 		}
 
+		// Wake up for the next line or at the end of the track
+		next := info.Length
 		if len(lyrics) > idx+1 {
-			n := lyrics[idx+1]
-			d := n.Timestamp - info.Position
-			if d <= 0 {
-				slog.Warn("Negative sleep time",
-					"duration", d.String(),
-					"position", info.Position.String(),
-					"next", n.Timestamp.String(),
-				)
-				continue
+			next = lyrics[idx+1].Timestamp
+		}
+		d := clock.RealTime(next - info.Position)
+		if !clock.Settled() && (d <= 0 || d > player.CoarseInterval) {
+			// Query coarse position until a step is observed
+			d = player.CoarseInterval
+		}
+		if loopIn > 0 && (d <= 0 || loopIn < d) {
+			d = loopIn
+		}
+		if d <= 0 {
+			lyricTimer.Stop()
+			continue
+		}
+		slog.Debug("Sleep",
+			"duration", d.String(),
+			"rate", info.Rate,
+			"position", info.Position.String(),
+			"next", next.String(),
+		)
+		lyricTimer.Reset(d)
+	}
+}
+
+// loadSleepTimer returns the sleep timer or nil if it's not set
+func loadSleepTimer() *sleep.Timer {
+	timer, err := sleep.Load()
+	if err != nil {
+		slog.Warn("Failed to load sleep timer", "error", err)
+	}
+	if timer != nil {
+		slog.Info("Sleep timer set", "until", timer.Until, "tracks", timer.Tracks)
+	}
+	return timer
+}
+
+// pauseAsleep fades out and pauses the player in background and removes the
+// sleep timer. The returned function cancels pausing and restores the volume.
+func pauseAsleep(ctx context.Context, mp *mpris.Player, fade time.Duration) context.CancelFunc {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		if err := sleep.Pause(ctx, mp, fade); err != nil {
+			slog.Error("Failed to pause player by sleep timer", "error", err)
+		}
+		if ctx.Err() == nil {
+			if err := sleep.Cancel(); err != nil {
+				slog.Error("Failed to remove sleep timer", "error", err)
 			}
-			slog.Debug("Sleep",
-				"duration", d.String(),
-				"position", info.Position.String(),
-				"next", n.Timestamp.String(),
-			)
-			lyricTicker.Reset(d)
 		}
+	}()
+	return cancel
+}
+
+// loadLoop returns the loop or nil if it's not set
+func loadLoop() *loop.Loop {
+	l, err := loop.Load()
+	if err != nil {
+		slog.Warn("Failed to load loop", "error", err)
+	}
+	if l != nil {
+		slog.Info("Loop set", "from", l.From.String(), "to", l.To.String())
 	}
+	return l
 }
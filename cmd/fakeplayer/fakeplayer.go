@@ -0,0 +1,134 @@
+package fakeplayer
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/fake"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/carapace-sh/carapace"
+	"github.com/spf13/cobra"
+)
+
+var (
+	lrcFile = ""
+	title   = ""
+	artist  = ""
+	album   = ""
+	length  = time.Duration(0)
+	name    = "fake"
+	loop    = false
+
+	replaceCache = false
+)
+
+func init() {
+	Command.Flags().StringVar(&lrcFile, "lrc", lrcFile, "LRC file with synced lyrics of the track")
+	Command.Flags().StringVar(&title, "title", title, "Track title (default: ti tag or file name)")
+	Command.Flags().StringVar(&artist, "artist", artist, "Track artist (default: ar tag)")
+	Command.Flags().StringVar(&album, "album", album, "Track album (default: al tag)")
+	Command.Flags().DurationVar(&length, "length", length, "Track length (default: length tag or "+fake.Outro.String()+" after the last line)")
+	Command.Flags().StringVar(&name, "name", name, "Player name, registered as org.mpris.MediaPlayer2.<name>")
+	Command.Flags().BoolVar(&loop, "loop", loop, "Restart the track when it ends")
+	Command.Flags().BoolVar(&replaceCache, "replace-cache", replaceCache, "Replace lyrics already cached for the track until the player exits")
+
+	Command.MarkFlagRequired("lrc")
+
+	carapace.Gen(Command).FlagCompletion(carapace.ActionMap{
+		"lrc": carapace.ActionFiles(".lrc"),
+	})
+}
+
+// Command is the fake-player command
+var Command = &cobra.Command{
+	Use: "fake-player",
+	Example: `  waybar-lyric fake-player --lrc song.lrc # Play song.lrc with ti, ar and length tags
+  waybar-lyric fake-player --lrc song.lrc --title Song --artist Artist --length 3m20s
+  dbus-run-session -- sh -c 'waybar-lyric fake-player --lrc song.lrc & waybar-lyric'`,
+	Short: "Run a fake mpris player which plays lyrics of a LRC file",
+	Long: `Run a fake mpris player which plays a silent track with lyrics of a LRC file.
+Position advances in real time and the player can be controlled like any other
+player, so waybar-lyric and its subcommands can run without a music player.
+Lyrics are written to the lyrics cache, so lrclib is never queried. The cache
+entry is removed when the player exits. If the track already has cached lyrics,
+e.g. with --id-strategy fake=artist-title, the player refuses to start unless
+--replace-cache is set, then the cached lyrics are restored on exit. If the
+player is killed, its lyrics stay in the cache until the next fake-player run,
+so point XDG_CACHE_HOME to a throwaway directory when replacing real lyrics.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, _ []string) error {
+		track, lyrics, err := fake.Load(lrcFile)
+		if err != nil {
+			return err
+		}
+		track.Title = cmp.Or(title, track.Title)
+		track.Artist = cmp.Or(artist, track.Artist)
+		track.Album = cmp.Or(album, track.Album)
+		if track.Artist == "" {
+			return errors.New("artist is required, use --artist or the ar tag")
+		}
+		if length < 0 {
+			return errors.New("track length must not be negative")
+		}
+		if length != 0 {
+			track.Length = length
+		}
+		if err := track.Validate(lyrics); err != nil {
+			return err
+		}
+
+		conn, err := bus.Session()
+		if err != nil {
+			return fmt.Errorf("failed to create dbus connection: %w", err)
+		}
+		slog.Debug("Created dbus session bus")
+
+		fp := fake.New(conn, track)
+		if loop {
+			fp.SetLoopStatus(mpris.LoopTrack)
+		}
+		if err := fp.Export(name); err != nil {
+			return fmt.Errorf("failed to register fake player: %w", err)
+		}
+		busName := mpris.BaseInterface + "." + name
+
+		// Parse the player like the main loop does, so the cache key matches
+		info, err := player.ParserFor(busName)(mpris.New(conn, busName))
+		if err != nil {
+			return fmt.Errorf("failed to parse player informations: %w", err)
+		}
+		restore, err := lyric.SaveFakeCache(info, lyrics, replaceCache)
+		if errors.Is(err, lyric.ErrCacheExists) {
+			return fmt.Errorf("%w, use --replace-cache to replace them while the player runs", err)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to cache lyrics: %w", err)
+		}
+		defer func() {
+			if err := restore(); err != nil {
+				slog.Error("Failed to restore lyrics cache", "error", err)
+			}
+		}()
+
+		slog.Info("Fake player is running", "name", busName, "title", track.Title, "artist", track.Artist, "length", track.Length)
+
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		select {
+		case <-cmd.Context().Done():
+		case <-sigChan:
+		case <-fp.Done():
+			slog.Info("Fake player quit by a client")
+		}
+		return nil
+	},
+}
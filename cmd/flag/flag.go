@@ -0,0 +1,56 @@
+package flag
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/spf13/cobra"
+)
+
+// Command is the flag command
+var Command = &cobra.Command{
+	Use:   "flag",
+	Short: "Flag lyrics of current track as wrong and try the next candidate",
+	Args:  cobra.NoArgs,
+
+	DisableFlagsInUseLine: true,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		conn, err := bus.Session()
+		if err != nil {
+			return fmt.Errorf("failed to create dbus connection: %w", err)
+		}
+		slog.Debug("Created dbus session bus")
+
+		mp, parser, err := player.Select(conn)
+		if err != nil {
+			return fmt.Errorf("failed to select player: %w", err)
+		}
+		slog.Debug("Selected player", "player", mp.GetName())
+
+		info, err := parser(mp)
+		if err != nil {
+			return fmt.Errorf("failed to parse player informations: %w", err)
+		}
+		slog.Debug("Parsed player information", "title", info.Title, "artist", info.Artist)
+
+		id, err := lyric.Flag(info)
+		if errors.Is(err, lyric.ErrNoCachedLyrics) || errors.Is(err, lyric.ErrNoLrclibID) {
+			return fmt.Errorf("failed to flag lyrics: %w", err)
+		}
+		if err != nil {
+			return fmt.Errorf("flagged lrclib lyrics %d, no other candidate found: %w", id, err)
+		}
+
+		next, err := lyric.CachedID(lyric.CacheKey(info))
+		if err != nil {
+			return fmt.Errorf("failed to read new lyrics: %w", err)
+		}
+
+		slog.Info("Replaced wrong lyrics", "flagged", id, "lrclib-id", next)
+		return nil
+	},
+}
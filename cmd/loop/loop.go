@@ -0,0 +1,128 @@
+package loop
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/loop"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/timeexpr"
+	"github.com/spf13/cobra"
+)
+
+var (
+	currentLine = false
+	cancel      = false
+)
+
+func init() {
+	Command.Flags().BoolVar(&currentLine, "line", currentLine, "Repeat current lyrics line")
+	Command.Flags().BoolVar(&cancel, "cancel", cancel, "Cancel loop")
+
+	Command.MarkFlagsMutuallyExclusive("line", "cancel")
+}
+
+// Command is the A-B loop command
+var Command = &cobra.Command{
+	Use: "loop [<from> <to>]",
+	Example: `  waybar-lyric loop 1:10 1:25 # Repeat from 1:10 to 1:25
+  waybar-lyric loop line:10 line:14 # Repeat lyrics lines 10 to 14
+  waybar-lyric loop --line # Repeat current lyrics line
+  waybar-lyric loop --cancel # Cancel loop
+  waybar-lyric loop # Show loop`,
+	Short: "Repeat part of current track",
+	Long: `Repeat part of current track. From and to accept the same expressions as
+position command. Lyrics lines are repeated until the end of the line. The
+loop is enforced by the running waybar-lyric and cancelled when track changes.`,
+	Args: cobra.MaximumNArgs(2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if cancel {
+			if err := loop.Cancel(); err != nil {
+				return err
+			}
+			slog.Info("Loop cancelled")
+			return nil
+		}
+
+		var from, to string
+		switch {
+		case currentLine && len(args) != 0:
+			return errors.New("from and to can't be used with --line")
+		case currentLine:
+			from, to = "start-of-line", "start-of-line"
+		case len(args) == 0:
+			return status()
+		case len(args) != 2:
+			return errors.New("loop requires both from and to")
+		default:
+			from, to = args[0], args[1]
+		}
+
+		fromExpr, err := timeexpr.Parse(from)
+		if err != nil {
+			return fmt.Errorf("failed to parse from: %w", err)
+		}
+		toExpr, err := timeexpr.Parse(to)
+		if err != nil {
+			return fmt.Errorf("failed to parse to: %w", err)
+		}
+
+		conn, err := bus.Session()
+		if err != nil {
+			return fmt.Errorf("failed to create dbus connection: %w", err)
+		}
+		slog.Debug("Created dbus session bus")
+
+		mp, parser, err := player.Select(conn)
+		if err != nil {
+			return fmt.Errorf("failed to select player: %w", err)
+		}
+		slog.Debug("Selected player", "player", mp.GetName())
+
+		info, err := parser(mp)
+		if err != nil {
+			return fmt.Errorf("failed to parse player informations: %w", err)
+		}
+
+		c, err := timeexpr.ForInfo(info, fromExpr.NeedsLyrics() || toExpr.NeedsLyrics())
+		if err != nil {
+			return err
+		}
+
+		// Bounds are resolved in corrected time, which the running waybar-lyric
+		// compares with its clock
+		l := loop.Loop{Set: time.Now(), Track: info.ID}
+		if l.From, err = fromExpr.Position(c); err != nil {
+			return fmt.Errorf("failed to resolve from: %w", err)
+		}
+		if l.To, err = toExpr.End(c); err != nil {
+			return fmt.Errorf("failed to resolve to: %w", err)
+		}
+		if l.To <= l.From {
+			return fmt.Errorf("loop end %s must be after start %s", l.To, l.From)
+		}
+
+		if err := l.Save(); err != nil {
+			return err
+		}
+		slog.Info("Loop set", "from", l.From, "to", l.To, "title", info.Title)
+		return nil
+	},
+}
+
+// status prints the loop
+func status() error {
+	l, err := loop.Load()
+	if err != nil {
+		return err
+	}
+	if l == nil {
+		fmt.Println("No loop")
+		return nil
+	}
+	fmt.Printf("Looping from %s to %s\n", l.From, l.To)
+	return nil
+}
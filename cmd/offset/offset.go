@@ -0,0 +1,79 @@
+package offset
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/state"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+)
+
+// Command is the lyrics offset command
+var Command = &cobra.Command{
+	Use: "offset [+/-]<offset>[m/s/ms]",
+	Example: `  waybar-lyric offset # Print the lyrics offset of current track
+  waybar-lyric offset 500ms # Show lyrics of current track 500 milliseconds later
+  waybar-lyric offset +100ms # Delay lyrics of current track by another 100 milliseconds
+  waybar-lyric offset -- -200ms # Show lyrics of current track 200 milliseconds earlier
+  waybar-lyric offset 0 # Reset lyrics offset of current track`,
+	Short: "Shift lyrics timing of current track",
+	Args:  cobra.MaximumNArgs(1),
+
+	DisableFlagsInUseLine: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		conn, err := bus.Session()
+		if err != nil {
+			return fmt.Errorf("failed to create dbus connection: %w", err)
+		}
+		slog.Debug("Created dbus session bus")
+
+		mp, parser, err := player.Select(conn)
+		if err != nil {
+			return fmt.Errorf("failed to select player: %w", err)
+		}
+		slog.Debug("Selected player", "player", mp.GetName())
+
+		info, err := parser(mp)
+		if err != nil {
+			return fmt.Errorf("failed to parse player informations: %w", err)
+		}
+		slog.Debug("Parsed player information", "title", info.Title, "artist", info.Artist)
+
+		key := lyric.CacheKey(info)
+
+		current, err := lyric.LoadOffset(key)
+		if err != nil {
+			return fmt.Errorf("failed to load lyrics offset: %w", err)
+		}
+
+		if len(args) == 0 {
+			_, err := fmt.Println(current)
+			return err
+		}
+
+		offset, err := cast.ToDurationE(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to convert duration: %w", err)
+		}
+
+		// Signed values are relative to the current offset
+		if strings.HasPrefix(args[0], "+") || strings.HasPrefix(args[0], "-") {
+			offset += current
+		}
+
+		slog.Info("Setting lyrics offset", "title", info.Title, "artist", info.Artist, "offset", offset)
+		if err := lyric.SaveOffset(key, offset); err != nil {
+			return fmt.Errorf("failed to save lyrics offset: %w", err)
+		}
+		if err := state.Save(lyric.OffsetState, key); err != nil {
+			slog.Warn("Failed to notify running instances", "error", err)
+		}
+
+		return nil
+	},
+}
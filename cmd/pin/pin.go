@@ -0,0 +1,53 @@
+package pin
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/spf13/cast"
+	"github.com/spf13/cobra"
+)
+
+// Command is the pin command
+var Command = &cobra.Command{
+	Use: "pin <lrclib-id>",
+	Example: `  waybar-lyric search # Find lrclib id of the correct lyrics
+  waybar-lyric pin 12345 # Use lrclib lyrics 12345 for current track`,
+	Short: "Bind lrclib lyrics to current track",
+	Args:  cobra.ExactArgs(1),
+
+	DisableFlagsInUseLine: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		id, err := cast.ToIntE(args[0])
+		if err != nil || id <= 0 {
+			return fmt.Errorf("invalid lrclib id: %s", args[0])
+		}
+
+		conn, err := bus.Session()
+		if err != nil {
+			return fmt.Errorf("failed to create dbus connection: %w", err)
+		}
+		slog.Debug("Created dbus session bus")
+
+		mp, parser, err := player.Select(conn)
+		if err != nil {
+			return fmt.Errorf("failed to select player: %w", err)
+		}
+		slog.Debug("Selected player", "player", mp.GetName())
+
+		info, err := parser(mp)
+		if err != nil {
+			return fmt.Errorf("failed to parse player informations: %w", err)
+		}
+		slog.Debug("Parsed player information", "title", info.Title, "artist", info.Artist)
+
+		if err := lyric.Pin(info, id); err != nil {
+			return fmt.Errorf("failed to pin lyrics: %w", err)
+		}
+
+		return nil
+	},
+}
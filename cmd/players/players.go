@@ -0,0 +1,59 @@
+package players
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/spf13/cobra"
+)
+
+var printJSON = false
+
+func init() {
+	Command.Flags().BoolVar(&printJSON, "json", printJSON, "Print players as JSON")
+}
+
+// Command is the players command
+var Command = &cobra.Command{
+	Use: "players",
+	Example: `  waybar-lyric players # List players and which one would be selected
+  waybar-lyric players --json # List players as JSON
+  waybar-lyric players -p 'firefox*' # Check which player matches --player patterns`,
+	Short: "List players and explain player selection",
+	Args:  cobra.NoArgs,
+	RunE: func(_ *cobra.Command, _ []string) error {
+		conn, err := bus.Session()
+		if err != nil {
+			return fmt.Errorf("failed to create dbus connection: %w", err)
+		}
+		slog.Debug("Created dbus session bus")
+
+		reports, err := player.Describe(conn)
+		if err != nil {
+			return fmt.Errorf("failed to list players: %w", err)
+		}
+		slog.Debug("Described players", "count", len(reports))
+
+		if printJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if reports == nil {
+				reports = []player.Report{}
+			}
+			return enc.Encode(reports)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PLAYER\tSTATUS\tARTIST\tTITLE\tHOST\tID STRATEGY\tSTATE\tREASON\t")
+		for _, r := range reports {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+				r.Name, r.Status, r.Artist, r.Title, r.Host, r.IDStrategy, r.State, r.Reason)
+		}
+		return w.Flush()
+	},
+}
@@ -4,8 +4,8 @@ import (
 	"log/slog"
 
 	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
 	"github.com/Nadim147c/waybar-lyric/internal/player"
-	"github.com/godbus/dbus/v5"
 	"github.com/spf13/cobra"
 )
 
@@ -14,10 +14,9 @@ var Command = &cobra.Command{
 	Use:          "play-pause",
 	Short:        "Toggle play-pause state",
 	SilenceUsage: true,
-	// Disable flag parsing
-	DisableFlagParsing: true,
+	Args:         cobra.NoArgs,
 	RunE: func(_ *cobra.Command, _ []string) error {
-		conn, err := dbus.SessionBus()
+		conn, err := bus.Session()
 		if err != nil {
 			slog.Error("Failed to create dbus connection", "error", err)
 			return err
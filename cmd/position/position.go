@@ -4,36 +4,48 @@ import (
 	"fmt"
 	"log/slog"
 
-	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
 	"github.com/Nadim147c/waybar-lyric/internal/player"
-	"github.com/godbus/dbus/v5"
-	"github.com/spf13/cast"
+	"github.com/Nadim147c/waybar-lyric/internal/timeexpr"
 	"github.com/spf13/cobra"
 )
 
 var lyricsLine bool
 
 func init() {
-	Command.Flags().BoolVarP(&lyricsLine, "lyric", "l", lyricsLine, "Set player position to lyrics line number")
+	Command.Flags().BoolVarP(&lyricsLine, "lyric", "l", lyricsLine, "Set player position to lyrics line number (same as line:<n>)")
 }
 
 // Command is the position changer command
 var Command = &cobra.Command{
-	Use: "position [+]<position>[m/s/ms/ns]",
+	Use: "position <position>",
 	Example: `  waybar-lyric position 20s # Set the player position to 20 seconds
-  waybar-lyric position --lyric 1 # Set the player position to first lyrics line
+  waybar-lyric position 1:23 # Set the player position to 1 minute 23 seconds
+  waybar-lyric position 50% # Set the player position to middle of the track
+  waybar-lyric position line:1 # Set the player position to first lyrics line
+  waybar-lyric position next-chorus # Set the player position to next chorus
+  waybar-lyric position start-of-line # Restart current lyrics line
   waybar-lyric position -- -10s # Set player position 10 seconds before the end`,
 	Short: "Set position player position",
-	Args:  cobra.ExactArgs(1),
+	Long: `Set position player position. Position can be a time (1:23, 20s), a percentage
+of track length (50%), a lyrics line (line:12, line:-1), lines relative to
+current line (+2lines, -1line), next-chorus or start-of-line. Times and
+percentages with - sign are from the end of the track.`,
+	Args: cobra.ExactArgs(1),
 
 	DisableFlagsInUseLine: true,
 	RunE: func(_ *cobra.Command, args []string) error {
-		pos, err := cast.ToDurationE(args[0])
+		arg := args[0]
+		if lyricsLine {
+			arg = "line:" + arg
+		}
+
+		expr, err := timeexpr.Parse(arg)
 		if err != nil {
-			return fmt.Errorf("failed to convert duration: %w", err)
+			return fmt.Errorf("failed to parse position: %w", err)
 		}
 
-		conn, err := dbus.SessionBus()
+		conn, err := bus.Session()
 		if err != nil {
 			return fmt.Errorf("failed to create dbus connection: %w", err)
 		}
@@ -45,46 +57,19 @@ var Command = &cobra.Command{
 		}
 		slog.Debug("Selected player", "player", mp.GetName())
 
-		if lyricsLine {
-			info, err := parser(mp)
-			if err != nil {
-				return fmt.Errorf("failed to parse player informations: %w", err)
-			}
-			slog.Debug("Parsed player information", "title", info.Title, "artist", info.Artist)
-
-			lyrics, err := lyric.GetLyrics(info)
-			if err != nil {
-				return fmt.Errorf("failed to fetch lyrics: %w", err)
-			}
-			slog.Debug("Fetched lyrics", "line-count", len(lyrics))
-
-			lineNumber := int(pos)
+		c, err := timeexpr.Load(mp, parser, expr.NeedsLyrics())
+		if err != nil {
+			return err
+		}
+		slog.Debug("Loaded player position", "position", c.Position, "length", c.Length, "line-count", len(c.Lyrics))
 
-			if lineNumber < 0 {
-				idx := len(lyrics) + lineNumber
-				if idx < 0 {
-					return fmt.Errorf("line number out of range (line-count=%d, requested=%d)", len(lyrics), lineNumber)
-				}
-				slog.Debug("Setting position from negative index", "line-number", lineNumber, "resolved-index", idx)
-				pos = lyrics[idx].Timestamp
-			} else {
-				if lineNumber > len(lyrics) {
-					return fmt.Errorf("line number out of range (line-count=%d, requested=%d)", len(lyrics), lineNumber)
-				}
-				slog.Debug("Setting position from positive line number", "line-number", lineNumber)
-				pos = lyrics[lineNumber].Timestamp
-			}
-		} else {
-			if pos < 0 {
-				slog.Debug("Negative duration detected. Trying to substract from song length", "position", pos)
-				length, err := mp.GetLength()
-				if err != nil {
-					return fmt.Errorf("failed to song duration: %v", err)
-				}
-				pos = max(0, length+pos)
-			}
+		pos, err := expr.Position(c)
+		if err != nil {
+			return fmt.Errorf("failed to resolve position: %w", err)
 		}
 
+		// Resolved positions are corrected by the latency like lyrics
+		pos = c.PlayerPosition(pos)
 		slog.Info("Setting player position", "player", mp.GetName(), "position", pos)
 		if err := mp.SetPosition(pos); err != nil {
 			return fmt.Errorf("failed to set player position: %w", err)
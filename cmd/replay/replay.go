@@ -0,0 +1,39 @@
+package replay
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Nadim147c/waybar-lyric/internal/record"
+	"github.com/carapace-sh/carapace"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	carapace.Gen(Command).PositionalCompletion(carapace.ActionFiles(".jsonl"))
+}
+
+// Command is the replay command
+var Command = &cobra.Command{
+	Use: "replay <file.jsonl>",
+	Example: `  waybar-lyric --record /tmp/session.jsonl # Record outputs
+  waybar-lyric replay /tmp/session.jsonl # Print recorded outputs with original timing`,
+	Short: "Replay outputs recorded with --record",
+	Long: `Replay outputs recorded with --record. Each output is printed at the time it
+was originally printed, and the reason why waybar-lyric printed it is logged.`,
+	Args: cobra.ExactArgs(1),
+
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to open recording: %w", err)
+		}
+		defer file.Close()
+
+		if err := record.Replay(cmd.Context(), file); err != nil {
+			return fmt.Errorf("failed to replay recording: %w", err)
+		}
+		return nil
+	},
+}
@@ -7,12 +7,27 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/Nadim147c/waybar-lyric/cmd/calibrate"
+	"github.com/Nadim147c/waybar-lyric/cmd/control"
+	"github.com/Nadim147c/waybar-lyric/cmd/fakeplayer"
+	flagcmd "github.com/Nadim147c/waybar-lyric/cmd/flag"
 	initcmd "github.com/Nadim147c/waybar-lyric/cmd/init"
+	loopcmd "github.com/Nadim147c/waybar-lyric/cmd/loop"
+	"github.com/Nadim147c/waybar-lyric/cmd/offset"
+	"github.com/Nadim147c/waybar-lyric/cmd/pin"
+	"github.com/Nadim147c/waybar-lyric/cmd/players"
 	"github.com/Nadim147c/waybar-lyric/cmd/playpause"
 	"github.com/Nadim147c/waybar-lyric/cmd/position"
+	"github.com/Nadim147c/waybar-lyric/cmd/replay"
+	"github.com/Nadim147c/waybar-lyric/cmd/search"
 	"github.com/Nadim147c/waybar-lyric/cmd/seek"
+	sleepcmd "github.com/Nadim147c/waybar-lyric/cmd/sleep"
 	"github.com/Nadim147c/waybar-lyric/cmd/volume"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
 	"github.com/Nadim147c/waybar-lyric/internal/config"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/sink"
 	"github.com/carapace-sh/carapace"
 	"github.com/charmbracelet/log"
 	"github.com/spf13/cobra"
@@ -28,10 +43,17 @@ func init() {
 	Command.Flags().IntVarP(&config.BreakTooltip, "break-tooltip", "b", config.BreakTooltip, "Break long lines in tooltip")
 	Command.Flags().IntVarP(&config.MaxTextLength, "max-length", "m", config.MaxTextLength, "Set maximum character length for lyrics text")
 	Command.Flags().IntVarP(&config.TooltipLines, "tooltip-lines", "L", config.TooltipLines, "Set maximum number of lines in waybar tooltip")
+	Command.Flags().IntVar(&config.RevalidateDays, "revalidate", config.RevalidateDays, "Re-check cached lyrics older than given days with lrclib (0 disables)")
 	Command.Flags().StringVarP(&config.FilterProfanityType, "filter-profanity", "f", config.FilterProfanityType, "Filter profanity from lyrics (values: full, partial)")
 	Command.Flags().StringVarP(&config.TooltipColor, "tooltip-color", "C", config.TooltipColor, "Set color for inactive lyrics lines")
 	Command.Flags().BoolVarP(&config.Simplify, "simplify", "s", config.Simplify, "lowercase + remove some other substitutions")
 
+	Command.Flags().StringVar(&config.Simulate, "simulate", config.Simulate, "Simulate output with lyrics of a LRC file without any player")
+	Command.Flags().StringVar(&config.SimulateSpeed, "speed", config.SimulateSpeed, "Speed of the simulation, e.g. 2x")
+	Command.Flags().DurationVar(&config.SimulatePauseAt, "pause-at", config.SimulatePauseAt, "Pause the simulation at given position (default: middle of the track)")
+
+	Command.Flags().StringVar(&config.RecordPath, "record", config.RecordPath, "Record every output with timing and player state into a JSON lines file")
+
 	Command.Flags().MarkDeprecated("init", "use 'waybar-lyric init'.")
 	Command.Flags().MarkDeprecated("toggle", "use 'waybar-lyric play-pause'.")
 
@@ -41,20 +63,42 @@ func init() {
 	Command.PersistentFlags().BoolVarP(&config.Quiet, "quiet", "q", config.Quiet, "Suppress all log output")
 	Command.PersistentFlags().BoolVarP(&config.Verbose, "verbose", "v", config.Verbose, "Enable verbose logging")
 	Command.PersistentFlags().StringVarP(&config.LogFilePath, "log-file", "o", config.LogFilePath, "Specify file path for saving logs")
+	Command.PersistentFlags().StringSliceVarP(&config.Players, "player", "p", config.Players, "Follow players matching glob patterns, in priority order")
+	Command.PersistentFlags().StringSliceVar(&config.IgnorePlayers, "ignore-player", config.IgnorePlayers, "Ignore players matching glob patterns")
+	Command.PersistentFlags().StringToStringVar(&config.IDStrategies, "id-strategy", config.IDStrategies, "Override track id strategy per player pattern (values: auto, trackid, url, web, artist-title)")
+	Command.PersistentFlags().StringVar(&config.LrclibDB, "lrclib-db", config.LrclibDB, "Query lyrics from local lrclib SQLite database dump before lrclib api (requires sqlite3)")
+	Command.PersistentFlags().StringToStringVar(&config.PlayerOffsets, "player-offset", config.PlayerOffsets, "Add position offset per player or website pattern, e.g. spotify=300ms")
+	Command.PersistentFlags().StringToStringVar(&config.SinkOffsets, "sink-offset", config.SinkOffsets, "Delay lyrics by latency of audio sink name or class pattern, e.g. bluez=200ms")
+	Command.PersistentFlags().StringVar(&config.BusAddress, "bus-address", config.BusAddress, "Connect to dbus at given address instead of the session bus (env: "+bus.AddressEnv+")")
+	Command.PersistentFlags().StringSliceVar(&config.CoarsePositions, "coarse-position", config.CoarsePositions, "Interpolate position of players or websites reporting whole seconds")
 
 	Command.MarkFlagsMutuallyExclusive("quiet", "verbose")
 	Command.MarkFlagsMutuallyExclusive("quiet", "log-file")
 
+	Command.AddCommand(calibrate.Command)
+	Command.AddCommand(control.Command)
+	Command.AddCommand(fakeplayer.Command)
+	Command.AddCommand(flagcmd.Command)
 	Command.AddCommand(initcmd.Command)
+	Command.AddCommand(loopcmd.Command)
+	Command.AddCommand(offset.Command)
+	Command.AddCommand(pin.Command)
+	Command.AddCommand(players.Command)
 	Command.AddCommand(playpause.Command)
 	Command.AddCommand(position.Command)
+	Command.AddCommand(replay.Command)
+	Command.AddCommand(search.Command)
 	Command.AddCommand(seek.Command)
+	Command.AddCommand(sleepcmd.Command)
 	Command.AddCommand(volume.Command)
 
 	comp := carapace.Gen(Command)
 	comp.Standalone()
 	comp.FlagCompletion(carapace.ActionMap{
-		"log-file": carapace.ActionFiles(),
+		"log-file":  carapace.ActionFiles(),
+		"lrclib-db": carapace.ActionFiles(),
+		"record":    carapace.ActionFiles(),
+		"simulate":  carapace.ActionFiles(".lrc"),
 	})
 }
 
@@ -75,8 +119,7 @@ var Command = &cobra.Command{
 	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
 		if config.ToggleState {
 			defer func() {
-				cmd.RemoveCommand(playpause.Command)
-				playpause.Command.Execute()
+				playpause.Command.RunE(playpause.Command, nil)
 				os.Exit(0)
 			}()
 		}
@@ -89,6 +132,10 @@ var Command = &cobra.Command{
 			}()
 		}
 
+		if config.BusAddress == "" {
+			config.BusAddress = os.Getenv(bus.AddressEnv)
+		}
+
 		switch config.FilterProfanityType {
 		case "":
 			config.FilterProfanity = false
@@ -102,6 +149,32 @@ var Command = &cobra.Command{
 			return errors.New("Tooltip lines limit must be at least 4")
 		}
 
+		if config.RevalidateDays < 0 {
+			return errors.New("Revalidate days must not be negative")
+		}
+
+		if err := player.ValidatePatterns(config.Players); err != nil {
+			return err
+		}
+		if err := player.ValidatePatterns(config.IgnorePlayers); err != nil {
+			return err
+		}
+		if err := player.ValidateIDStrategies(config.IDStrategies); err != nil {
+			return err
+		}
+		if err := player.ValidatePlayerOffsets(config.PlayerOffsets); err != nil {
+			return err
+		}
+		if err := player.ValidatePatterns(config.CoarsePositions); err != nil {
+			return err
+		}
+		if err := sink.ValidateOffsets(config.SinkOffsets); err != nil {
+			return err
+		}
+		if err := lyric.ValidateDump(config.LrclibDB); err != nil {
+			return err
+		}
+
 		if config.Quiet {
 			slog.SetDefault(slog.New(&noopHandler{}))
 			return nil
@@ -0,0 +1,97 @@
+package search
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/spf13/cobra"
+)
+
+// Command is the search command
+var Command = &cobra.Command{
+	Use: "search [artist] [title]",
+	Example: `  waybar-lyric search # Search lyrics candidates for current track
+  waybar-lyric search "Daft Punk" "One More Time" # Search lyrics candidates by artist and title
+  waybar-lyric search "one more time" # Search lyrics candidates with free text`,
+	Short: "List lrclib lyrics candidates",
+	Args:  cobra.MaximumNArgs(2),
+
+	DisableFlagsInUseLine: true,
+	RunE: func(_ *cobra.Command, args []string) error {
+		query := url.Values{}
+		var key string
+
+		switch len(args) {
+		case 2:
+			query.Set("artist_name", args[0])
+			query.Set("track_name", args[1])
+		case 1:
+			query.Set("q", args[0])
+		default:
+			conn, err := bus.Session()
+			if err != nil {
+				return fmt.Errorf("failed to create dbus connection: %w", err)
+			}
+			slog.Debug("Created dbus session bus")
+
+			mp, parser, err := player.Select(conn)
+			if err != nil {
+				return fmt.Errorf("failed to select player: %w", err)
+			}
+			slog.Debug("Selected player", "player", mp.GetName())
+
+			info, err := parser(mp)
+			if err != nil {
+				return fmt.Errorf("failed to parse player informations: %w", err)
+			}
+			slog.Debug("Parsed player information", "title", info.Title, "artist", info.Artist)
+
+			query = lyric.Query(info)
+			key = lyric.CacheKey(info)
+		}
+
+		candidates, err := lyric.Candidates(query)
+		if err != nil {
+			return fmt.Errorf("failed to search lyrics: %w", err)
+		}
+		slog.Debug("Found lyrics candidates", "count", len(candidates))
+
+		var current int
+		var denied []int
+		if key != "" {
+			current, _ = lyric.CachedID(key)
+			denied, _ = lyric.Denylist(key)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tDURATION\tSYNCED\tARTIST\tTITLE\tALBUM\t")
+		for _, c := range candidates {
+			synced := "no"
+			if c.SyncedLyrics != "" {
+				synced = "yes"
+			}
+
+			var mark string
+			switch {
+			case c.ID == current:
+				mark = "(current)"
+			case slices.Contains(denied, c.ID):
+				mark = "(flagged)"
+			}
+
+			duration := time.Duration(c.Duration * float64(time.Second)).Round(time.Second)
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				c.ID, duration, synced, c.ArtistName, c.TrackName, c.AlbumName, mark)
+		}
+
+		return w.Flush()
+	},
+}
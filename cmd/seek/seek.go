@@ -3,38 +3,48 @@ package seek
 import (
 	"fmt"
 	"log/slog"
-	"time"
 
-	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
 	"github.com/Nadim147c/waybar-lyric/internal/player"
-	"github.com/godbus/dbus/v5"
-	"github.com/spf13/cast"
+	"github.com/Nadim147c/waybar-lyric/internal/timeexpr"
 	"github.com/spf13/cobra"
 )
 
 var lyricsLine bool
 
 func init() {
-	Command.Flags().BoolVarP(&lyricsLine, "lyric", "l", lyricsLine, "Set player seek to lyrics line number")
+	Command.Flags().BoolVarP(&lyricsLine, "lyric", "l", lyricsLine, "Seek by lyrics lines (same as <n>lines)")
 }
 
 // Command is the position seeker command
 var Command = &cobra.Command{
-	Use: "seek [+/-]<offset>[m/s/ms/ns]",
+	Use: "seek [+/-]<offset>",
 	Example: `  waybar-lyric seek 20s # Seeks 20 seconds ahead
+  waybar-lyric seek 10% # Seeks 10% of the track ahead
+  waybar-lyric seek +1line # Seeks to next lyric line
   waybar-lyric seek --lyric 1 # Seeks to next lyric line
-  waybar-lyric seek -- -10s # Go back 20 seconds`,
+  waybar-lyric seek next-chorus # Seeks to next chorus
+  waybar-lyric seek -- -10s # Go back 10 seconds`,
 	Short: "Seek player position",
-	Args:  cobra.ExactArgs(1),
+	Long: `Seek player position. Offset can be a time (1:23, 20s), a percentage of track
+length (10%), lines relative to current line (+2lines, -1line), a lyrics line
+(line:12), next-chorus or start-of-line. Times and percentages with - sign
+seek backward.`,
+	Args: cobra.ExactArgs(1),
 
 	DisableFlagsInUseLine: true,
 	RunE: func(_ *cobra.Command, args []string) error {
-		offset, err := cast.ToDurationE(args[0])
+		arg := args[0]
+		if lyricsLine {
+			arg += "lines"
+		}
+
+		expr, err := timeexpr.Parse(arg)
 		if err != nil {
-			return fmt.Errorf("failed to convert duration: %w", err)
+			return fmt.Errorf("failed to parse offset: %w", err)
 		}
 
-		conn, err := dbus.SessionBus()
+		conn, err := bus.Session()
 		if err != nil {
 			return fmt.Errorf("failed to create dbus connection: %w", err)
 		}
@@ -46,7 +56,7 @@ var Command = &cobra.Command{
 		}
 		slog.Debug("Selected player", "player", mp.GetName())
 
-		if !lyricsLine {
+		if offset, ok := expr.Offset(); ok {
 			slog.Info("Seeking player position", "player", mp.GetName(), "offset", offset)
 			if err := mp.Seek(offset); err != nil {
 				return fmt.Errorf("failed to set player position: %w", err)
@@ -54,49 +64,20 @@ var Command = &cobra.Command{
 			return nil
 		}
 
-		info, err := parser(mp)
+		c, err := timeexpr.Load(mp, parser, expr.NeedsLyrics())
 		if err != nil {
-			return fmt.Errorf("failed to parse player informations: %w", err)
+			return err
 		}
-		slog.Debug("Parsed player information", "title", info.Title, "artist", info.Artist)
+		slog.Debug("Loaded player position", "position", c.Position, "length", c.Length, "line-count", len(c.Lyrics))
 
-		lyrics, err := lyric.GetLyrics(info)
+		pos, err := expr.Seek(c)
 		if err != nil {
-			return fmt.Errorf("failed to fetch lyrics: %w", err)
-		}
-		slog.Debug("Fetched lyrics", "line-count", len(lyrics))
-
-		info.UpdatePosition(mp)
-
-		var currentIndex int
-		for i, line := range lyrics {
-			if info.Position <= line.Timestamp {
-				break
-			}
-			currentIndex = i
-		}
-
-		slog.Debug("Current Line", "number", currentIndex)
-
-		lineNumber := currentIndex + int(offset)
-
-		var pos time.Duration
-		if lineNumber < 0 {
-			idx := len(lyrics) + lineNumber
-			if idx < 0 {
-				return fmt.Errorf("line number out of range (line-count=%d, requested=%d)", len(lyrics), lineNumber)
-			}
-			slog.Debug("Setting position from negative index", "line-number", lineNumber, "resolved-index", idx)
-			pos = lyrics[idx].Timestamp
-		} else {
-			if lineNumber > len(lyrics) {
-				return fmt.Errorf("line number out of range (line-count=%d, requested=%d)", len(lyrics), lineNumber)
-			}
-			slog.Debug("Setting position from positive line number", "line-number", lineNumber)
-			pos = lyrics[lineNumber].Timestamp
+			return fmt.Errorf("failed to resolve offset: %w", err)
 		}
 
-		slog.Info("Setting player position", "player", mp.GetName(), "position", pos, "line-number", lineNumber)
+		// Resolved positions are corrected by the latency like lyrics
+		pos = c.PlayerPosition(pos)
+		slog.Info("Setting player position", "player", mp.GetName(), "position", pos)
 		if err := mp.SetPosition(pos); err != nil {
 			return fmt.Errorf("failed to set player position: %w", err)
 		}
@@ -0,0 +1,102 @@
+package sleep
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/sleep"
+	"github.com/spf13/cobra"
+)
+
+var (
+	endOfTrack = false
+	after      = 0
+	fade       = sleep.DefaultFade
+	cancel     = false
+)
+
+func init() {
+	Command.Flags().BoolVar(&endOfTrack, "end-of-track", endOfTrack, "Pause at the end of current track")
+	Command.Flags().IntVar(&after, "after", after, "Pause at the end of given number of tracks, including current track")
+	Command.Flags().DurationVar(&fade, "fade", fade, "Fade out volume over given duration before pausing")
+	Command.Flags().BoolVar(&cancel, "cancel", cancel, "Cancel sleep timer")
+
+	Command.MarkFlagsMutuallyExclusive("end-of-track", "after", "cancel")
+}
+
+// Command is the sleep timer command
+var Command = &cobra.Command{
+	Use: "sleep [duration]",
+	Example: `  waybar-lyric sleep 30m # Pause player after 30 minutes
+  waybar-lyric sleep --end-of-track # Pause player at the end of current track
+  waybar-lyric sleep --after 3 # Pause player at the end of third track
+  waybar-lyric sleep --cancel # Cancel sleep timer
+  waybar-lyric sleep # Show sleep timer`,
+	Short: "Pause player after a duration or a number of tracks",
+	Long: `Pause player after a duration or a number of tracks. Volume fades out before
+pausing and is restored afterward. The timer is enforced by the running
+waybar-lyric, which shows the remaining time with the sleep class.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if len(args) != 0 && (endOfTrack || after != 0 || cancel) {
+			return errors.New("duration can't be used with --end-of-track, --after or --cancel")
+		}
+		if fade < 0 {
+			return errors.New("fade duration must not be negative")
+		}
+
+		timer := sleep.Timer{Set: time.Now(), Fade: fade}
+		switch {
+		case cancel:
+			if err := sleep.Cancel(); err != nil {
+				return err
+			}
+			slog.Info("Sleep timer cancelled")
+			return nil
+		case len(args) != 0:
+			d, err := time.ParseDuration(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to parse duration: %w", err)
+			}
+			if d <= 0 {
+				return errors.New("duration must be positive")
+			}
+			timer.Until = timer.Set.Add(d)
+		case endOfTrack:
+			timer.Tracks = 1
+		case after > 0:
+			timer.Tracks = after
+		case after < 0:
+			return errors.New("number of tracks must be positive")
+		default:
+			return status()
+		}
+
+		if err := timer.Save(); err != nil {
+			return err
+		}
+		slog.Info("Sleep timer set", "until", timer.Until, "tracks", timer.Tracks, "fade", timer.Fade)
+		return nil
+	},
+}
+
+// status prints the sleep timer
+func status() error {
+	timer, err := sleep.Load()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case timer == nil:
+		fmt.Println("No sleep timer")
+	case !timer.Until.IsZero():
+		left := time.Until(timer.Until).Round(time.Second)
+		fmt.Printf("Pausing in %s\n", max(left, 0))
+	default:
+		fmt.Printf("Pausing after %d tracks\n", timer.Tracks)
+	}
+	return nil
+}
@@ -1,28 +1,48 @@
 package volume
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/bus"
 	"github.com/Nadim147c/waybar-lyric/internal/player"
-	"github.com/godbus/dbus/v5"
+	"github.com/Nadim147c/waybar-lyric/internal/state"
 	"github.com/spf13/cast"
 	"github.com/spf13/cobra"
 )
 
+var fadeDuration time.Duration
+
+func init() {
+	Command.Flags().DurationVar(&fadeDuration, "fade", fadeDuration, "Change volume gradually over given duration")
+}
+
 // Command is the volume changer command
 var Command = &cobra.Command{
-	Use: "volume [+/-]<volume>[%]",
+	Use: "volume [+/-]<volume>[%] | mute | unmute | toggle-mute",
 	Example: `  waybar-lyric volume 20% # Set player volume to 20%
   waybar-lyric volume 0.5 # Set player volume to 50%
   waybar-lyric volume +10% # Increase player volume by 10%
-  waybar-lyric volume -5% # Decrease player volume by 5%`,
-	Short: "Set player volume",
-	Args:  cobra.ExactArgs(1),
+  waybar-lyric volume -5% # Decrease player volume by 5%
+  waybar-lyric volume --fade 2s 80% # Fade player volume to 80% in 2 seconds
+  waybar-lyric volume toggle-mute # Mute player or restore volume before muting`,
+	Short:     "Set player volume",
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"mute", "unmute", "toggle-mute"},
 
 	DisableFlagsInUseLine: true,
-	RunE: func(_ *cobra.Command, args []string) error {
+	RunE: func(cmd *cobra.Command, args []string) error {
+		switch args[0] {
+		case "mute", "unmute", "toggle-mute":
+			return mute(cmd.Context(), args[0])
+		}
+
 		volStr := args[0]
 		var volume float64
 		relative := false
@@ -60,19 +80,11 @@ var Command = &cobra.Command{
 			return fmt.Errorf("volume is out of range. volume=%.2f", volume)
 		}
 
-		conn, err := dbus.SessionBus()
-		if err != nil {
-			return fmt.Errorf("failed to create dbus connection: %w", err)
-		}
-		slog.Debug("Created dbus session bus")
-
-		mp, _, err := player.Select(conn)
+		mp, err := selectPlayer()
 		if err != nil {
-			return fmt.Errorf("failed to select player: %w", err)
+			return err
 		}
 
-		slog.Debug("Selected player", "player", mp.GetName())
-
 		// Handle relative volume adjustment
 		if relative {
 			currentVol, err := mp.GetVolume()
@@ -90,7 +102,7 @@ var Command = &cobra.Command{
 		}
 
 		slog.Info("Setting player volume", "volume", volume)
-		if err := mp.SetVolume(volume); err != nil {
+		if err := player.Fade(cmd.Context(), mp, volume, fadeDuration); err != nil {
 			slog.Error("Failed to set volume", "error", err)
 			return err
 		}
@@ -98,3 +110,81 @@ var Command = &cobra.Command{
 		return nil
 	},
 }
+
+// selectPlayer selects the player to change volume of
+func selectPlayer() (*mpris.Player, error) {
+	conn, err := bus.Session()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dbus connection: %w", err)
+	}
+	slog.Debug("Created dbus session bus")
+
+	mp, _, err := player.Select(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select player: %w", err)
+	}
+	slog.Debug("Selected player", "player", mp.GetName())
+	return mp, nil
+}
+
+// mutedState is the state file with player volumes before muting
+const mutedState = "volume"
+
+// mute mutes or unmutes the player. The volume before muting is saved per
+// player and restored when unmuting.
+func mute(ctx context.Context, action string) error {
+	mp, err := selectPlayer()
+	if err != nil {
+		return err
+	}
+
+	current, err := mp.GetVolume()
+	if err != nil {
+		return fmt.Errorf("failed to get current volume: %w", err)
+	}
+
+	levels := map[string]float64{}
+	if err := state.Load(mutedState, &levels); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to load volume state", "error", err)
+	}
+	name := player.ShortName(mp.GetName())
+
+	if action == "toggle-mute" {
+		action = "mute"
+		if current == 0 {
+			action = "unmute"
+		}
+	}
+
+	switch action {
+	case "mute":
+		if current == 0 {
+			slog.Info("Player is already muted")
+			return nil
+		}
+		levels[name] = current
+		if err := state.Save(mutedState, levels); err != nil {
+			return fmt.Errorf("failed to save volume state: %w", err)
+		}
+		slog.Info("Muting player", "volume", current)
+		return player.Fade(ctx, mp, 0, fadeDuration)
+	default:
+		if current != 0 {
+			slog.Info("Player is not muted", "volume", current)
+			return nil
+		}
+		level, ok := levels[name]
+		if !ok || level == 0 {
+			return fmt.Errorf("no volume saved for %s, set volume instead", name)
+		}
+		slog.Info("Unmuting player", "volume", level)
+		if err := player.Fade(ctx, mp, level, fadeDuration); err != nil {
+			return err
+		}
+		delete(levels, name)
+		if err := state.Save(mutedState, levels); err != nil {
+			slog.Warn("Failed to save volume state", "error", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package bus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/config"
+	"github.com/godbus/dbus/v5"
+)
+
+// AddressEnv is the environment variable for the bus address. It's used when
+// --bus-address is not set.
+const AddressEnv = "WAYBAR_LYRIC_BUS_ADDRESS"
+
+const (
+	// MinBackoff is the time before the first reconnection attempt
+	MinBackoff = 500 * time.Millisecond
+	// MaxBackoff is the maximum time between reconnection attempts
+	MaxBackoff = 30 * time.Second
+)
+
+// ErrDisconnected is returned when the session bus connection is closed
+var ErrDisconnected = errors.New("dbus connection closed")
+
+var (
+	mu     sync.Mutex
+	shared *dbus.Conn
+)
+
+// Session returns a shared connection to the bus at --bus-address, or to the
+// session bus when it's not set. It reconnects if the connection is closed.
+func Session() (*dbus.Conn, error) {
+	if config.BusAddress == "" {
+		return dbus.SessionBus()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if shared != nil && shared.Connected() {
+		return shared, nil
+	}
+
+	slog.Debug("Connecting to dbus", "address", config.BusAddress)
+	conn, err := dbus.Connect(config.BusAddress)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", config.BusAddress, err)
+	}
+	shared = conn
+	return conn, nil
+}
+
+// Connect connects to the bus using Session. It retries with exponential backoff
+// until it succeeds or ctx is done. retry is called before each wait.
+func Connect(ctx context.Context, retry func(err error, wait time.Duration)) (*dbus.Conn, error) {
+	wait := MinBackoff
+	for {
+		conn, err := Session()
+		if err == nil {
+			return conn, nil
+		}
+
+		retry(err, wait)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, MaxBackoff)
+	}
+}
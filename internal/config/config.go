@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 var (
 	PrintInit       = false
 	PrintVersion    = false
@@ -16,8 +18,26 @@ var (
 	FilterProfanity = false
 	Simplify        = false
 	LogFilePath     = ""
+	RevalidateDays  = 0
+	LrclibDB        = ""
 
 	FilterProfanityType = ""
 
+	Players       = []string{}
+	IgnorePlayers = []string{}
+	IDStrategies  = map[string]string{}
+
+	PlayerOffsets   = map[string]string{}
+	CoarsePositions = []string{"YoutubeMusic", "music.youtube.com"}
+	SinkOffsets     = map[string]string{}
+
+	BusAddress = ""
+
+	Simulate        = ""
+	SimulateSpeed   = "1x"
+	SimulatePauseAt = time.Duration(0)
+
+	RecordPath = ""
+
 	Version = "waybar-lyric v0.12.2 (https://github.com/Nadim147c/waybar-lyric)"
 )
@@ -0,0 +1,479 @@
+package fake
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+)
+
+const (
+	// Path is the object path of mpris players
+	Path = "/org/mpris/MediaPlayer2"
+	// Identity is the name of the fake player shown to users
+	Identity = "waybar-lyric fake player"
+
+	// MinimumRate is the slowest playback rate of the fake player
+	MinimumRate = 0.25
+	// MaximumRate is the fastest playback rate of the fake player
+	MaximumRate = 4.0
+
+	// Outro is the length of the track after the last lyrics line when the
+	// LRC file has no length tag
+	Outro = 5 * time.Second
+
+	propertiesInterface = "org.freedesktop.DBus.Properties"
+	propertiesChanged   = propertiesInterface + ".PropertiesChanged"
+	seeked              = mpris.PlayerInterface + ".Seeked"
+)
+
+// ErrNameTaken is returned when another player owns the bus name
+var ErrNameTaken = errors.New("bus name is already taken")
+
+// Track is the track played by the fake player
+type Track struct {
+	Title  string
+	Artist string
+	Album  string
+	Length time.Duration
+}
+
+// Load reads the track and lyrics of a LRC file. Title, artist, album and
+// length are read from ID tags, title defaults to the file name and length to
+// Outro after the last line. Artist is empty when the file has no ar tag.
+func Load(path string) (Track, shared.Lyrics, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Track{}, nil, fmt.Errorf("failed to read lrc file: %w", err)
+	}
+
+	lyrics, err := lyric.ParseLyrics(string(content))
+	if err != nil {
+		return Track{}, nil, fmt.Errorf("failed to parse lrc file: %w", err)
+	}
+
+	tags := lyric.ParseTags(string(content))
+	track := Track{
+		Title:  cmp.Or(tags["ti"], strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))),
+		Artist: tags["ar"],
+		Album:  tags["al"],
+		Length: lyrics[len(lyrics)-1].Timestamp + Outro,
+	}
+	if tags["length"] != "" {
+		track.Length, err = lyric.ParseTimestamp(tags["length"])
+		if err != nil {
+			return Track{}, nil, fmt.Errorf("invalid length tag: %w", err)
+		}
+	}
+	return track, lyrics, nil
+}
+
+// Validate checks if the track is long enough for the lyrics
+func (t Track) Validate(lyrics shared.Lyrics) error {
+	if last := lyrics[len(lyrics)-1].Timestamp; t.Length <= last {
+		return fmt.Errorf("track length %s is shorter than the lyrics", t.Length)
+	}
+	return nil
+}
+
+// TrackID returns mpris:trackid of the track. It only depends on artist and
+// title, so it's stable across restarts.
+func (t Track) TrackID() dbus.ObjectPath {
+	sum := sha256.Sum256([]byte(t.Artist + "\x00" + t.Title))
+	return dbus.ObjectPath(fmt.Sprintf("/org/waybar_lyric/track/track_%x", sum[:8]))
+}
+
+// metadata returns mpris metadata of the track
+func (t Track) metadata() map[string]dbus.Variant {
+	meta := map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(t.TrackID()),
+		"mpris:length":  dbus.MakeVariant(t.Length.Microseconds()),
+		"xesam:title":   dbus.MakeVariant(t.Title),
+		"xesam:artist":  dbus.MakeVariant([]string{t.Artist}),
+	}
+	if t.Album != "" {
+		meta["xesam:album"] = dbus.MakeVariant(t.Album)
+	}
+	return meta
+}
+
+// Player is a mpris player which plays a silent track. Position advances in
+// real time and every method of org.mpris.MediaPlayer2.Player except OpenUri
+// is implemented.
+type Player struct {
+	conn  *dbus.Conn
+	track Track
+
+	quit     chan struct{}
+	quitOnce sync.Once
+
+	mu      sync.Mutex
+	status  mpris.PlaybackStatus
+	loop    mpris.LoopStatus
+	shuffle bool
+	rate    float64
+	volume  float64
+	// offset is the position when playback last started, stopped or moved
+	offset time.Duration
+	since  time.Time
+	// end fires when the track ends while playing
+	end *time.Timer
+}
+
+// New creates a fake player which starts playing the track once exported
+func New(conn *dbus.Conn, track Track) *Player {
+	return &Player{
+		conn:   conn,
+		track:  track,
+		quit:   make(chan struct{}),
+		status: mpris.PlaybackPlaying,
+		loop:   mpris.LoopNone,
+		rate:   1,
+		volume: 1,
+		since:  time.Now(),
+	}
+}
+
+// Export registers the player on the bus as org.mpris.MediaPlayer2.<name>
+func (p *Player) Export(name string) error {
+	root := map[string]any{
+		"Raise": func() *dbus.Error { return nil },
+		"Quit":  p.quitMethod,
+	}
+	control := map[string]any{
+		"Next":        func() *dbus.Error { return nil }, // CanGoNext is false
+		"Previous":    func() *dbus.Error { return nil }, // CanGoPrevious is false
+		"Pause":       p.pause,
+		"PlayPause":   p.playPause,
+		"Stop":        p.stop,
+		"Play":        p.play,
+		"Seek":        p.seek,
+		"SetPosition": p.setPositionMethod,
+		"OpenUri":     p.openURI,
+	}
+	properties := map[string]any{
+		"Get":    p.get,
+		"GetAll": p.getAll,
+		"Set":    p.set,
+	}
+
+	exports := []struct {
+		table map[string]any
+		iface string
+	}{
+		{root, mpris.BaseInterface},
+		{control, mpris.PlayerInterface},
+		{properties, propertiesInterface},
+	}
+	for _, e := range exports {
+		if err := p.conn.ExportMethodTable(e.table, Path, e.iface); err != nil {
+			return fmt.Errorf("failed to export %s: %w", e.iface, err)
+		}
+	}
+	err := p.conn.Export(introspect.Introspectable(introspection), Path, "org.freedesktop.DBus.Introspectable")
+	if err != nil {
+		return fmt.Errorf("failed to export introspection: %w", err)
+	}
+
+	p.mu.Lock()
+	p.since = time.Now()
+	p.schedule()
+	p.mu.Unlock()
+
+	reply, err := p.conn.RequestName(mpris.BaseInterface+"."+name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		return fmt.Errorf("failed to request bus name: %w", err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		return fmt.Errorf("%w: %s", ErrNameTaken, mpris.BaseInterface+"."+name)
+	}
+	return nil
+}
+
+// Done is closed when a client calls Quit
+func (p *Player) Done() <-chan struct{} {
+	return p.quit
+}
+
+// SetLoopStatus sets whether the track restarts when it ends
+func (p *Player) SetLoopStatus(loop mpris.LoopStatus) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loop = loop
+	p.changed(mpris.PlayerInterface, "LoopStatus")
+}
+
+// position returns the current playback position. mu must be held.
+func (p *Player) position() time.Duration {
+	pos := p.offset
+	if p.status == mpris.PlaybackPlaying {
+		pos += time.Duration(float64(time.Since(p.since)) * p.rate)
+	}
+	return min(pos, p.track.Length)
+}
+
+// moveTo moves the playback position. mu must be held.
+func (p *Player) moveTo(pos time.Duration) {
+	p.offset, p.since = pos, time.Now()
+	p.schedule()
+}
+
+// setStatus changes the playback status. mu must be held.
+func (p *Player) setStatus(status mpris.PlaybackStatus) {
+	if status == p.status {
+		return
+	}
+
+	pos := p.position()
+	if status == mpris.PlaybackStopped {
+		pos = 0
+	}
+	p.status = status
+	p.moveTo(pos)
+	p.changed(mpris.PlayerInterface, "PlaybackStatus")
+}
+
+// schedule starts the timer for the end of the track. mu must be held.
+func (p *Player) schedule() {
+	if p.end != nil {
+		p.end.Stop()
+	}
+	if p.status != mpris.PlaybackPlaying {
+		return
+	}
+	left := time.Duration(float64(p.track.Length-p.position()) / p.rate)
+	p.end = time.AfterFunc(left, p.finish)
+}
+
+// finish is called by the end timer
+func (p *Player) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// The timer may fire after playback was moved
+	if p.status != mpris.PlaybackPlaying || p.position() < p.track.Length {
+		return
+	}
+	p.endOfTrack()
+}
+
+// endOfTrack restarts the track when looping, otherwise stops playback. mu
+// must be held.
+func (p *Player) endOfTrack() {
+	if p.loop == mpris.LoopNone {
+		p.setStatus(mpris.PlaybackStopped)
+		return
+	}
+	p.moveTo(0)
+	p.seeked()
+}
+
+// changed emits PropertiesChanged signal for the properties. mu must be held.
+func (p *Player) changed(iface string, names ...string) {
+	all, _ := p.properties(iface)
+	props := make(map[string]dbus.Variant, len(names))
+	for _, name := range names {
+		props[name] = all[name]
+	}
+	p.conn.Emit(Path, propertiesChanged, iface, props, []string{})
+}
+
+// seeked emits Seeked signal with current position. mu must be held.
+func (p *Player) seeked() {
+	p.conn.Emit(Path, seeked, p.position().Microseconds())
+}
+
+func (p *Player) quitMethod() *dbus.Error {
+	p.quitOnce.Do(func() { close(p.quit) })
+	return nil
+}
+
+func (p *Player) play() *dbus.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setStatus(mpris.PlaybackPlaying)
+	return nil
+}
+
+func (p *Player) pause() *dbus.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status == mpris.PlaybackPlaying {
+		p.setStatus(mpris.PlaybackPaused)
+	}
+	return nil
+}
+
+func (p *Player) playPause() *dbus.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.status == mpris.PlaybackPlaying {
+		p.setStatus(mpris.PlaybackPaused)
+	} else {
+		p.setStatus(mpris.PlaybackPlaying)
+	}
+	return nil
+}
+
+func (p *Player) stop() *dbus.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setStatus(mpris.PlaybackStopped)
+	return nil
+}
+
+func (p *Player) seek(offset int64) *dbus.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pos := max(p.position()+time.Duration(offset)*time.Microsecond, 0)
+	if pos >= p.track.Length {
+		p.endOfTrack() // Seeking past the end acts like Next
+		return nil
+	}
+	p.moveTo(pos)
+	p.seeked()
+	return nil
+}
+
+func (p *Player) setPositionMethod(trackID dbus.ObjectPath, position int64) *dbus.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pos := time.Duration(position) * time.Microsecond
+	// Stale requests for other tracks and positions out of range are ignored
+	if trackID != p.track.TrackID() || pos < 0 || pos > p.track.Length {
+		return nil
+	}
+	p.moveTo(pos)
+	p.seeked()
+	return nil
+}
+
+func (p *Player) openURI(string) *dbus.Error {
+	return dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []any{"fake player can't open uris"})
+}
+
+// properties returns properties of the interface. mu must be held.
+func (p *Player) properties(iface string) (map[string]dbus.Variant, bool) {
+	switch iface {
+	case mpris.BaseInterface:
+		return map[string]dbus.Variant{
+			"CanQuit":             dbus.MakeVariant(true),
+			"CanRaise":            dbus.MakeVariant(false),
+			"HasTrackList":        dbus.MakeVariant(false),
+			"Identity":            dbus.MakeVariant(Identity),
+			"SupportedUriSchemes": dbus.MakeVariant([]string{}),
+			"SupportedMimeTypes":  dbus.MakeVariant([]string{}),
+		}, true
+	case mpris.PlayerInterface:
+		return map[string]dbus.Variant{
+			"PlaybackStatus": dbus.MakeVariant(string(p.status)),
+			"LoopStatus":     dbus.MakeVariant(string(p.loop)),
+			"Rate":           dbus.MakeVariant(p.rate),
+			"Shuffle":        dbus.MakeVariant(p.shuffle),
+			"Metadata":       dbus.MakeVariant(p.track.metadata()),
+			"Volume":         dbus.MakeVariant(p.volume),
+			"Position":       dbus.MakeVariant(p.position().Microseconds()),
+			"MinimumRate":    dbus.MakeVariant(MinimumRate),
+			"MaximumRate":    dbus.MakeVariant(MaximumRate),
+			"CanGoNext":      dbus.MakeVariant(false),
+			"CanGoPrevious":  dbus.MakeVariant(false),
+			"CanPlay":        dbus.MakeVariant(true),
+			"CanPause":       dbus.MakeVariant(true),
+			"CanSeek":        dbus.MakeVariant(true),
+			"CanControl":     dbus.MakeVariant(true),
+		}, true
+	}
+	return nil, false
+}
+
+func (p *Player) get(iface, name string) (dbus.Variant, *dbus.Error) {
+	props, err := p.getAll(iface)
+	if err != nil {
+		return dbus.Variant{}, err
+	}
+	v, ok := props[name]
+	if !ok {
+		return dbus.Variant{}, errUnknownProperty(name)
+	}
+	return v, nil
+}
+
+func (p *Player) getAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	props, ok := p.properties(iface)
+	if !ok {
+		return nil, dbus.NewError("org.freedesktop.DBus.Error.UnknownInterface", []any{"unknown interface " + iface})
+	}
+	return props, nil
+}
+
+func (p *Player) set(iface, name string, value dbus.Variant) *dbus.Error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.properties(iface); !ok {
+		return dbus.NewError("org.freedesktop.DBus.Error.UnknownInterface", []any{"unknown interface " + iface})
+	}
+
+	switch iface + "." + name {
+	case mpris.PlayerInterface + ".LoopStatus":
+		loop, ok := value.Value().(string)
+		switch mpris.LoopStatus(loop) {
+		case mpris.LoopNone, mpris.LoopTrack, mpris.LoopPlaylist:
+		default:
+			ok = false
+		}
+		if !ok {
+			return errInvalidArgs(name, value)
+		}
+		p.loop = mpris.LoopStatus(loop)
+	case mpris.PlayerInterface + ".Rate":
+		rate, ok := value.Value().(float64)
+		if !ok || rate < MinimumRate || rate > MaximumRate {
+			return errInvalidArgs(name, value)
+		}
+		p.offset, p.since = p.position(), time.Now()
+		p.rate = rate
+		p.schedule()
+	case mpris.PlayerInterface + ".Shuffle":
+		shuffle, ok := value.Value().(bool)
+		if !ok {
+			return errInvalidArgs(name, value)
+		}
+		p.shuffle = shuffle
+	case mpris.PlayerInterface + ".Volume":
+		volume, ok := value.Value().(float64)
+		if !ok {
+			return errInvalidArgs(name, value)
+		}
+		p.volume = max(volume, 0)
+	default:
+		return dbus.NewError("org.freedesktop.DBus.Error.PropertyReadOnly", []any{name + " is read only"})
+	}
+
+	p.changed(iface, name)
+	return nil
+}
+
+func errUnknownProperty(name string) *dbus.Error {
+	return dbus.NewError("org.freedesktop.DBus.Error.UnknownProperty", []any{"unknown property " + name})
+}
+
+func errInvalidArgs(name string, value dbus.Variant) *dbus.Error {
+	return dbus.NewError("org.freedesktop.DBus.Error.InvalidArgs", []any{fmt.Sprintf("invalid value %s for %s", value, name)})
+}
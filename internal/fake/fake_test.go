@@ -0,0 +1,296 @@
+package fake
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/godbus/dbus/v5"
+)
+
+func TestTrackID(t *testing.T) {
+	track := Track{Title: "Song", Artist: "Artist", Length: time.Minute}
+
+	id := track.TrackID()
+	if !id.IsValid() {
+		t.Fatalf("TrackID() = %q is not a valid object path", id)
+	}
+	if again := (Track{Title: "Song", Artist: "Artist", Album: "Album"}).TrackID(); again != id {
+		t.Errorf("TrackID() changed with album and length: %q != %q", again, id)
+	}
+	if other := (Track{Title: "Other", Artist: "Artist"}).TrackID(); other == id {
+		t.Errorf("TrackID() = %q for different tracks", other)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	meta := Track{Title: "Song", Artist: "Artist", Length: time.Minute}.metadata()
+
+	if got := meta["mpris:length"].Value(); got != time.Minute.Microseconds() {
+		t.Errorf("mpris:length = %v, want %d", got, time.Minute.Microseconds())
+	}
+	if _, ok := meta["xesam:album"]; ok {
+		t.Error("xesam:album is set without album")
+	}
+}
+
+// busConfig is the configuration of a private bus for the tests
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+// privateBus starts a dbus-daemon for the test and returns its address. The
+// test is skipped if dbus-daemon is not installed.
+func privateBus(t *testing.T) string {
+	t.Helper()
+
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(config, fmt.Appendf(nil, busConfig, dir), 0644); err != nil {
+		t.Fatalf("Failed to write bus config: %v", err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Failed to start dbus-daemon: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+// connect connects to the bus at address
+func connect(t *testing.T, address string) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatalf("Failed to connect to private bus: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// newPlayer returns a paused fake player at position pos, connected to a
+// private bus but not exported
+func newPlayer(t *testing.T, track Track, pos time.Duration) *Player {
+	t.Helper()
+
+	p := New(connect(t, privateBus(t)), track)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.setStatus(mpris.PlaybackPaused)
+	p.moveTo(pos)
+	return p
+}
+
+// state returns status and position of the player
+func (p *Player) state() (mpris.PlaybackStatus, time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status, p.position()
+}
+
+func TestSeekPastEnd(t *testing.T) {
+	track := Track{Title: "Song", Artist: "Artist", Length: time.Minute}
+
+	tests := []struct {
+		name       string
+		loop       mpris.LoopStatus
+		wantStatus mpris.PlaybackStatus
+	}{
+		{"without loop", mpris.LoopNone, mpris.PlaybackStopped},
+		{"with loop", mpris.LoopTrack, mpris.PlaybackPaused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPlayer(t, track, 50*time.Second)
+			p.SetLoopStatus(tt.loop)
+
+			if err := p.seek(time.Minute.Microseconds()); err != nil {
+				t.Fatalf("seek() failed: %v", err)
+			}
+
+			status, pos := p.state()
+			if status != tt.wantStatus || pos != 0 {
+				t.Errorf("After seeking past the end = %s at %v, want %s at 0s", status, pos, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestSetPosition(t *testing.T) {
+	track := Track{Title: "Song", Artist: "Artist", Length: time.Minute}
+	p := newPlayer(t, track, 10*time.Second)
+
+	stale := Track{Title: "Other", Artist: "Artist"}.TrackID()
+	if err := p.setPositionMethod(stale, (20 * time.Second).Microseconds()); err != nil {
+		t.Fatalf("setPositionMethod() failed: %v", err)
+	}
+	if _, pos := p.state(); pos != 10*time.Second {
+		t.Errorf("Position after SetPosition with stale track id = %v, want 10s", pos)
+	}
+
+	if err := p.setPositionMethod(track.TrackID(), (2 * time.Minute).Microseconds()); err != nil {
+		t.Fatalf("setPositionMethod() failed: %v", err)
+	}
+	if _, pos := p.state(); pos != 10*time.Second {
+		t.Errorf("Position after SetPosition past the end = %v, want 10s", pos)
+	}
+
+	if err := p.setPositionMethod(track.TrackID(), (20 * time.Second).Microseconds()); err != nil {
+		t.Fatalf("setPositionMethod() failed: %v", err)
+	}
+	if _, pos := p.state(); pos != 20*time.Second {
+		t.Errorf("Position after SetPosition = %v, want 20s", pos)
+	}
+}
+
+func TestRateReschedulesEnd(t *testing.T) {
+	track := Track{Title: "Song", Artist: "Artist", Length: time.Second}
+	p := newPlayer(t, track, 0)
+
+	if err := p.play(); err != nil {
+		t.Fatalf("play() failed: %v", err)
+	}
+	// The track ends after 250ms instead of a second
+	if err := p.set(mpris.PlayerInterface, "Rate", dbus.MakeVariant(MaximumRate)); err != nil {
+		t.Fatalf("set() Rate failed: %v", err)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if status, _ := p.state(); status != mpris.PlaybackStopped {
+		t.Errorf("Status after the end at maximum rate = %s, want %s", status, mpris.PlaybackStopped)
+	}
+}
+
+func TestProperties_Errors(t *testing.T) {
+	p := newPlayer(t, Track{Title: "Song", Artist: "Artist", Length: time.Minute}, 0)
+
+	_, err := p.get("org.example.Unknown", "Position")
+	if err == nil || err.Name != "org.freedesktop.DBus.Error.UnknownInterface" {
+		t.Errorf("get() on unknown interface = %v, want UnknownInterface", err)
+	}
+	_, err = p.get(mpris.PlayerInterface, "Unknown")
+	if err == nil || err.Name != "org.freedesktop.DBus.Error.UnknownProperty" {
+		t.Errorf("get() unknown property = %v, want UnknownProperty", err)
+	}
+
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"Position", int64(0), "org.freedesktop.DBus.Error.PropertyReadOnly"},
+		{"Rate", 10.0, "org.freedesktop.DBus.Error.InvalidArgs"},
+		{"Rate", "fast", "org.freedesktop.DBus.Error.InvalidArgs"},
+		{"LoopStatus", "Forever", "org.freedesktop.DBus.Error.InvalidArgs"},
+		{"Shuffle", "yes", "org.freedesktop.DBus.Error.InvalidArgs"},
+		{"Volume", true, "org.freedesktop.DBus.Error.InvalidArgs"},
+	}
+	for _, tt := range tests {
+		err := p.set(mpris.PlayerInterface, tt.name, dbus.MakeVariant(tt.value))
+		if err == nil || err.Name != tt.want {
+			t.Errorf("set(%s, %v) = %v, want %s", tt.name, tt.value, err, tt.want)
+		}
+	}
+
+	if err := p.set(mpris.BaseInterface, "Identity", dbus.MakeVariant("other")); err == nil {
+		t.Error("set() Identity succeeded, want PropertyReadOnly")
+	}
+}
+
+func TestExport(t *testing.T) {
+	address := privateBus(t)
+	track := Track{Title: "Song", Artist: "Artist", Length: time.Minute}
+
+	p := New(connect(t, address), track)
+	if err := p.Export("test"); err != nil {
+		t.Fatalf("Export() failed: %v", err)
+	}
+	if err := New(connect(t, address), track).Export("test"); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("Export() with taken name = %v, want ErrNameTaken", err)
+	}
+
+	client := connect(t, address)
+	obj := client.Object(mpris.BaseInterface+".test", Path)
+
+	status, err := obj.GetProperty(mpris.PlayerInterface + ".PlaybackStatus")
+	if err != nil || status.Value() != string(mpris.PlaybackPlaying) {
+		t.Errorf("PlaybackStatus = %v, %v, want %s", status, err, mpris.PlaybackPlaying)
+	}
+
+	meta, err := obj.GetProperty(mpris.PlayerInterface + ".Metadata")
+	if err != nil {
+		t.Fatalf("Failed to get Metadata: %v", err)
+	}
+	if id := meta.Value().(map[string]dbus.Variant)["mpris:trackid"].Value(); id != track.TrackID() {
+		t.Errorf("mpris:trackid = %v, want %s", id, track.TrackID())
+	}
+
+	err = client.AddMatchSignal(dbus.WithMatchInterface(mpris.PlayerInterface), dbus.WithMatchMember("Seeked"))
+	if err != nil {
+		t.Fatalf("Failed to watch Seeked signal: %v", err)
+	}
+	signals := make(chan *dbus.Signal, 1)
+	client.Signal(signals)
+
+	if err := obj.Call(mpris.PlayerInterface+".Pause", 0).Err; err != nil {
+		t.Fatalf("Pause failed: %v", err)
+	}
+	if err := obj.Call(mpris.PlayerInterface+".SetPosition", 0, track.TrackID(), (30 * time.Second).Microseconds()).Err; err != nil {
+		t.Fatalf("SetPosition failed: %v", err)
+	}
+
+	select {
+	case sig := <-signals:
+		if pos := sig.Body[0]; pos != (30 * time.Second).Microseconds() {
+			t.Errorf("Seeked position = %v, want %d", pos, (30 * time.Second).Microseconds())
+		}
+	case <-time.After(time.Second):
+		t.Error("Seeked signal was not emitted")
+	}
+
+	if err := obj.Call(mpris.BaseInterface+".Quit", 0).Err; err != nil {
+		t.Fatalf("Quit failed: %v", err)
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(time.Second):
+		t.Error("Done() was not closed after Quit")
+	}
+}
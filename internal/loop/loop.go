@@ -0,0 +1,56 @@
+package loop
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/state"
+)
+
+// State is the name of the loop state file
+const State = "loop"
+
+// Loop repeats part of a track. It's enforced by the running waybar-lyric,
+// which seeks back to From whenever position passes To.
+type Loop struct {
+	// Set is when the loop was set
+	Set time.Time `json:"set"`
+	// Track is the ID of the looped track. The loop is cancelled when the
+	// track changes.
+	Track string `json:"track"`
+	// From and To are positions corrected by the latency of the player, like
+	// lyrics timestamps and the position of the running waybar-lyric
+	From time.Duration `json:"from"`
+	To   time.Duration `json:"to"`
+}
+
+// Load returns the loop or nil if there is no loop
+func Load() (*Loop, error) {
+	var l Loop
+	err := state.Load(State, &l)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load loop: %w", err)
+	}
+	return &l, nil
+}
+
+// Save saves the loop
+func (l *Loop) Save() error {
+	if err := state.Save(State, l); err != nil {
+		return fmt.Errorf("failed to save loop: %w", err)
+	}
+	return nil
+}
+
+// Cancel removes the loop
+func Cancel() error {
+	if err := state.Remove(State); err != nil {
+		return fmt.Errorf("failed to remove loop: %w", err)
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -23,6 +24,15 @@ import (
 type storeValue struct {
 	LastAccess time.Time
 	Lyrics     shared.Lyrics
+	// ModTime is modification time of the cache file the lyrics were loaded
+	// from. It's zero when lyrics are not cached on disk.
+	ModTime time.Time
+	// Checked is when ModTime was last compared with the cache file
+	Checked time.Time
+	// Offset is the persisted timing offset of the track, valid when
+	// OffsetLoaded is set
+	Offset       time.Duration
+	OffsetLoaded bool
 }
 
 // store is used to cache lyrics in memory
@@ -40,11 +50,77 @@ func newStore() *store {
 
 // Save saves lyrics to Store
 func (s *store) Save(id string, lyrics shared.Lyrics) {
+	s.SaveFile(id, lyrics, time.Time{})
+}
+
+// SaveFile saves lyrics to Store with the modification time of the cache file
+func (s *store) SaveFile(id string, lyrics shared.Lyrics, modTime time.Time) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	now := time.Now()
 	s.data[id] = &storeValue{
-		LastAccess: time.Now(),
+		LastAccess: now,
 		Lyrics:     lyrics,
+		ModTime:    modTime,
+		Checked:    now,
+	}
+}
+
+// LoadFile loads lyrics from Store if the cache file has not been modified
+// since the lyrics were saved, by this or another process
+func (s *store) LoadFile(key string, modTime time.Time) (shared.Lyrics, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, exists := s.data[key]
+	if !exists || !v.ModTime.Equal(modTime) {
+		return nil, false
+	}
+	v.LastAccess = time.Now() // Update last access time
+	v.Checked = v.LastAccess
+	return v.Lyrics, true
+}
+
+// LoadChecked loads lyrics from Store if the cache file was checked by
+// LoadFile within the interval
+func (s *store) LoadChecked(key string, interval time.Duration) (shared.Lyrics, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, exists := s.data[key]
+	if !exists || time.Since(v.Checked) >= interval {
+		return nil, false
+	}
+	v.LastAccess = time.Now() // Update last access time
+	return v.Lyrics, true
+}
+
+// Offset loads the timing offset of the track from Store. It returns false if
+// the offset has not been loaded since the lyrics were saved or the offset was
+// forgotten.
+func (s *store) Offset(key string) (time.Duration, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, exists := s.data[key]
+	if !exists || !v.OffsetLoaded {
+		return 0, false
+	}
+	return v.Offset, true
+}
+
+// SaveOffset saves the timing offset of the track next to its lyrics
+func (s *store) SaveOffset(key string, offset time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, exists := s.data[key]; exists {
+		v.Offset, v.OffsetLoaded = offset, true
+	}
+}
+
+// ForgetOffset makes the timing offset of the track load again
+func (s *store) ForgetOffset(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, exists := s.data[key]; exists {
+		v.Offset, v.OffsetLoaded = 0, false
 	}
 }
 
@@ -60,6 +136,13 @@ func (s *store) Load(key string) (shared.Lyrics, bool) {
 	return v.Lyrics, true
 }
 
+// Delete removes lyrics from Store
+func (s *store) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+}
+
 // Cleanup runs a blocking loop that periodically removes unused entries
 // until the context is canceled.
 func (s *store) Cleanup(ctx context.Context, interval time.Duration) {
@@ -90,6 +173,13 @@ func (s *store) cleanupExpired(threshold time.Duration) {
 // CacheDir is waybar-lyric lyrics cache dir
 var CacheDir string
 
+// ErrCorruptCache is returned when a cache file can not be parsed
+var ErrCorruptCache = errors.New("corrupt lyrics cache")
+
+// ErrCacheExists is returned by SaveFakeCache when lyrics of the track are
+// already cached
+var ErrCacheExists = errors.New("lyrics of the track are already cached")
+
 func init() {
 	userCacheDir, err := os.UserCacheDir()
 	if err != nil {
@@ -104,17 +194,28 @@ func init() {
 	}
 }
 
-// SaveCache saves the lyrics to cache
-func SaveCache(info *player.Info, lines shared.Lyrics, filePath string) error {
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
+// Cache header keys written by waybar-lyric
+const (
+	headerLrclibID = "LRCLIB_ID"
+	headerQuery    = "LRCLIB_QUERY"
+	headerStatus   = "STATUS"
+	headerFake     = "FAKE"
+
+	statusNotFound = "not-found"
+)
+
+// headerLine formats a cache header line
+func headerLine(key, value string) string {
+	return fmt.Sprintf("# %s: %s", key, value)
+}
+
+// cacheHeader returns header lines with player info and metadata
+func cacheHeader(info *player.Info) []string {
+	header := []string{
+		headerLine("PLAYER", info.Player),
+		headerLine("ID", info.ID),
 	}
-	defer file.Close()
 
-	// Write player info as comments before lyrics
-	fmt.Fprintf(file, "# PLAYER: %s\n", info.Player)
-	fmt.Fprintf(file, "# ID: %s\n", info.ID)
 	metaLines := make([]string, 0, len(info.Metadata))
 	for k, v := range info.Metadata {
 		// Convert metadata key to SNAKE_CASE
@@ -129,25 +230,142 @@ func SaveCache(info *player.Info, lines shared.Lyrics, filePath string) error {
 			}
 			key.WriteRune(unicode.ToUpper(r))
 		}
-		metaLines = append(metaLines, fmt.Sprintf("# %s: %s", key.String(), v))
+		metaLines = append(metaLines, headerLine(key.String(), v.String()))
 	}
 
 	slices.SortFunc(metaLines, func(a, b string) int {
 		return strings.Compare(a, b)
 	})
 
-	for line := range slices.Values(metaLines) {
-		fmt.Fprintln(file, line)
+	return append(header, metaLines...)
+}
+
+// SaveCache saves the lyrics to cache. The file is replaced atomically so
+// concurrent readers never see a partially written cache.
+func SaveCache(info *player.Info, lines shared.Lyrics, filePath string) error {
+	return writeCache(filePath, cacheHeader(info), lines)
+}
+
+// SaveFakeCache caches lyrics of the fake player for the track and returns a
+// function which restores the cache. Existing caches are only replaced when
+// replace is set, except caches left behind by a killed fake player.
+func SaveFakeCache(info *player.Info, lyrics shared.Lyrics, replace bool) (func() error, error) {
+	key := CacheKey(info)
+	filePath := CachePath(key)
+
+	unlock := Lock(key)
+	defer unlock()
+
+	header, err := readHeader(filePath)
+	exists := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	fake := slices.Contains(header, headerLine(headerFake, "true"))
+	if exists && !fake && !replace {
+		return nil, fmt.Errorf("%w: %s", ErrCacheExists, filePath)
 	}
 
-	// Write lyrics
-	for line := range slices.Values(lines) {
-		_, err := fmt.Fprintf(file, "%d,%s\n", line.Timestamp, line.Text)
-		if err != nil {
+	var prev shared.Lyrics
+	var modified time.Time
+	if exists && !fake {
+		prev, err = LoadCache(filePath)
+		if err != nil && !errors.Is(err, ErrLyricsNotExists) {
+			return nil, err
+		}
+		modified = modTime(filePath)
+	}
+
+	if err := writeCache(filePath, append(cacheHeader(info), headerLine(headerFake, "true")), lyrics); err != nil {
+		return nil, err
+	}
+	Store.Delete(key)
+
+	return func() error {
+		unlock := Lock(key)
+		defer unlock()
+		defer Store.Delete(key)
+
+		if !exists || fake {
+			err := os.Remove(filePath)
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
 			return err
 		}
+
+		if err := writeCache(filePath, header, prev); err != nil {
+			return err
+		}
+		// Restored cache keeps its revalidation age
+		return os.Chtimes(filePath, modified, modified)
+	}, nil
+}
+
+// writeCache writes header lines as comments before lyrics
+func writeCache(filePath string, header []string, lines shared.Lyrics) error {
+	return writeAtomic(filePath, func(file io.Writer) error {
+		for line := range slices.Values(header) {
+			fmt.Fprintln(file, line)
+		}
+
+		// Write lyrics
+		for line := range slices.Values(lines) {
+			_, err := fmt.Fprintf(file, "%d,%s\n", line.Timestamp, line.Text)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// modTime returns modification time of the file or zero if it doesn't exist
+func modTime(filePath string) time.Time {
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return time.Time{}
+	}
+	return stat.ModTime()
+}
+
+// writeAtomic writes a file by writing to a temporary file in the same
+// directory and renaming it over filePath once write succeeds.
+func writeAtomic(filePath string, write func(io.Writer) error) error {
+	dir, base := filepath.Split(filePath)
+	file, err := os.CreateTemp(dir, base+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // no-op after successful rename
+	defer file.Close()
+
+	buf := bufio.NewWriter(file)
+	if err := write(buf); err != nil {
+		return err
+	}
+	if err := buf.Flush(); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
 	}
-	return nil
+
+	return os.Rename(file.Name(), filePath)
+}
+
+// quarantine moves a corrupt cache file out of the way so it can be inspected
+// later without being loaded again.
+func quarantine(filePath string) {
+	corrupt := filePath + ".corrupt"
+	if err := os.Rename(filePath, corrupt); err != nil {
+		slog.Error("Failed to quarantine corrupt cache", "file", filePath, "error", err)
+		return
+	}
+	slog.Warn("Quarantined corrupt cache", "file", corrupt)
 }
 
 // LoadCache loads the lyrics from cache
@@ -159,11 +377,15 @@ func LoadCache(filePath string) (shared.Lyrics, error) {
 	defer file.Close()
 
 	var lyrics shared.Lyrics
+	var missing bool
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
 		line := scanner.Text()
 		if strings.HasPrefix(line, "#") {
+			if line == headerLine(headerStatus, statusNotFound) {
+				missing = true
+			}
 			continue
 		}
 
@@ -174,7 +396,7 @@ func LoadCache(filePath string) (shared.Lyrics, error) {
 
 		ts, err := strconv.Atoi(parts[0])
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("%w: %w", ErrCorruptCache, err)
 		}
 
 		timestamp := time.Duration(ts)
@@ -188,9 +410,51 @@ func LoadCache(filePath string) (shared.Lyrics, error) {
 		return nil, err
 	}
 
+	if missing {
+		return nil, ErrLyricsNotExists
+	}
+
 	if len(lyrics) == 0 {
 		return nil, errors.New("Number of line found is zero")
 	}
 
 	return lyrics, nil
 }
+
+// readHeader reads the comment lines at the start of the cache file
+func readHeader(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var header []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "#") {
+			break
+		}
+		header = append(header, line)
+	}
+
+	return header, scanner.Err()
+}
+
+// ReadHeader reads the header of the cache file as key value pairs
+func ReadHeader(filePath string) (map[string]string, error) {
+	lines, err := readHeader(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	header := map[string]string{}
+	for line := range slices.Values(lines) {
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "# "), ": ")
+		if ok {
+			header[key] = value
+		}
+	}
+	return header, nil
+}
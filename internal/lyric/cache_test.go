@@ -1,9 +1,13 @@
 package lyric
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/Nadim147c/waybar-lyric/internal/player"
 	"github.com/Nadim147c/waybar-lyric/internal/shared"
 )
 
@@ -92,3 +96,122 @@ func TestStore_CleanupLoop(t *testing.T) {
 		t.Error("New entry was incorrectly cleaned up")
 	}
 }
+
+func TestSaveCache_LoadCache(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.csv")
+	info := &player.Info{Player: "org.mpris.MediaPlayer2.test", ID: "test-id"}
+	lyrics := shared.Lyrics{
+		{Timestamp: 0},
+		{Timestamp: time.Second, Text: "Hello, world"},
+	}
+
+	if err := SaveCache(info, lyrics, filePath); err != nil {
+		t.Fatalf("SaveCache() failed: %v", err)
+	}
+
+	loaded, err := LoadCache(filePath)
+	if err != nil {
+		t.Fatalf("LoadCache() failed: %v", err)
+	}
+	if len(loaded) != 2 || loaded[1] != lyrics[1] {
+		t.Errorf("LoadCache() = %v, want %v", loaded, lyrics)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(filePath))
+	if len(entries) != 1 {
+		t.Errorf("SaveCache() left temporary files behind: %v", entries)
+	}
+}
+
+func TestLoadCache_Corrupt(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "test.csv")
+	os.WriteFile(filePath, []byte("# ID: test\n0,\n10000000\n2000000x,torn"), 0644)
+
+	_, err := LoadCache(filePath)
+	if !errors.Is(err, ErrCorruptCache) {
+		t.Fatalf("LoadCache() error = %v, want ErrCorruptCache", err)
+	}
+
+	quarantine(filePath)
+	if _, err := os.Stat(filePath + ".corrupt"); err != nil {
+		t.Errorf("Corrupt cache was not quarantined: %v", err)
+	}
+}
+
+func TestStore_LoadFile(t *testing.T) {
+	s := newStore()
+	modTime := time.Now()
+	s.SaveFile("test-id", shared.Lyrics{{Text: "Hello"}}, modTime)
+
+	if _, ok := s.LoadFile("test-id", modTime); !ok {
+		t.Error("Lyrics not found with same modification time")
+	}
+
+	// Cache file was replaced by another process
+	if _, ok := s.LoadFile("test-id", modTime.Add(time.Second)); ok {
+		t.Error("Lyrics found after cache file was modified")
+	}
+}
+
+func TestSaveFakeCache(t *testing.T) {
+	CacheDir = t.TempDir()
+	info := &player.Info{Player: "org.mpris.MediaPlayer2.fake", ID: "test-id"}
+	filePath := CachePath(CacheKey(info))
+	real := shared.Lyrics{{}, {Timestamp: time.Second, Text: "Real"}}
+	fake := shared.Lyrics{{}, {Timestamp: time.Second, Text: "Fake"}}
+
+	// Without a cache the fake cache is removed on restore
+	restore, err := SaveFakeCache(info, fake, false)
+	if err != nil {
+		t.Fatalf("SaveFakeCache() failed: %v", err)
+	}
+	if err := restore(); err != nil {
+		t.Fatalf("restore() failed: %v", err)
+	}
+	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("restore() kept the fake cache: %v", err)
+	}
+
+	// Real caches are only replaced when allowed, and restored
+	if err := SaveCache(info, real, filePath); err != nil {
+		t.Fatalf("SaveCache() failed: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	os.Chtimes(filePath, old, old)
+
+	if _, err := SaveFakeCache(info, fake, false); !errors.Is(err, ErrCacheExists) {
+		t.Fatalf("SaveFakeCache() over real cache = %v, want ErrCacheExists", err)
+	}
+	restore, err = SaveFakeCache(info, fake, true)
+	if err != nil {
+		t.Fatalf("SaveFakeCache() with replace failed: %v", err)
+	}
+	if loaded, _ := LoadCache(filePath); loaded[1].Text != "Fake" {
+		t.Errorf("SaveFakeCache() cached %v, want fake lyrics", loaded)
+	}
+	if err := restore(); err != nil {
+		t.Fatalf("restore() failed: %v", err)
+	}
+	if loaded, _ := LoadCache(filePath); loaded[1].Text != "Real" {
+		t.Errorf("restore() cached %v, want real lyrics", loaded)
+	}
+	if !modTime(filePath).Equal(old) {
+		t.Errorf("restore() changed modification time to %v, want %v", modTime(filePath), old)
+	}
+
+	// Caches left by a killed fake player are replaced
+	os.Remove(filePath)
+	if _, err := SaveFakeCache(info, fake, false); err != nil {
+		t.Fatalf("SaveFakeCache() failed: %v", err)
+	}
+	restore, err = SaveFakeCache(info, fake, false)
+	if err != nil {
+		t.Fatalf("SaveFakeCache() over fake cache failed: %v", err)
+	}
+	if err := restore(); err != nil {
+		t.Fatalf("restore() failed: %v", err)
+	}
+	if _, err := os.Stat(filePath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("restore() kept the fake cache: %v", err)
+	}
+}
@@ -0,0 +1,333 @@
+package lyric
+
+import (
+	"bufio"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+// headerPinned marks lyrics chosen by user with the pin command
+const headerPinned = "PINNED"
+
+var (
+	//revive:disable
+	ErrNoCachedLyrics = errors.New("no cached lrclib lyrics for the track")
+	ErrNoLrclibID     = errors.New("cached lyrics have no lrclib id")
+	//revive:enable
+)
+
+// DenylistPath returns path of the file with lrclib ids flagged as wrong for
+// given cache key
+func DenylistPath(key string) string {
+	return filepath.Join(CacheDir, key+".deny")
+}
+
+// Denylist returns lrclib ids flagged as wrong lyrics for given cache key
+func Denylist(key string) ([]int, error) {
+	file, err := os.Open(DenylistPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var ids []int
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		id, err := strconv.Atoi(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			continue // Skip invalid lines
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, scanner.Err()
+}
+
+// IsDenied reports whether lrclib id is flagged as wrong for given cache key
+func IsDenied(key string, id int) bool {
+	ids, err := Denylist(key)
+	if err != nil {
+		slog.Warn("Failed to read denylist", "error", err)
+	}
+	return slices.Contains(ids, id)
+}
+
+// saveDenylist writes the denylist, removing the file if ids is empty
+func saveDenylist(key string, ids []int) error {
+	if len(ids) == 0 {
+		err := os.Remove(DenylistPath(key))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return writeAtomic(DenylistPath(key), func(w io.Writer) error {
+		for id := range slices.Values(ids) {
+			if _, err := fmt.Fprintln(w, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CachedID returns lrclib id of cached lyrics for given cache key. Caches
+// written by older versions don't have the id and return ErrNoLrclibID.
+func CachedID(key string) (int, error) {
+	header, err := ReadHeader(CachePath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, ErrNoCachedLyrics
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if header[headerStatus] == statusNotFound {
+		return 0, ErrNoCachedLyrics
+	}
+
+	value, ok := header[headerLrclibID]
+	if !ok {
+		return 0, ErrNoLrclibID
+	}
+	return strconv.Atoi(value)
+}
+
+// Flag denylists the cached lrclib lyrics of the track, evicts the cache and
+// fetches the next search candidate. It returns the flagged lrclib id. If the
+// cache has no lrclib id, it's recovered by looking up the track again. When
+// that fails the cache is evicted without denylisting and ErrNoLrclibID is
+// returned.
+func Flag(info *player.Info) (int, error) {
+	key := CacheKey(info)
+
+	var recovered int
+	_, err := CachedID(key)
+	if errors.Is(err, ErrNoLrclibID) {
+		recovered, err = recoverID(key, info)
+		if err != nil {
+			slog.Warn("Failed to recover lrclib id of cached lyrics", "error", err)
+		}
+	} else if err != nil {
+		return 0, err
+	}
+
+	id, err := evict(key, recovered)
+	if err != nil {
+		return 0, err
+	}
+
+	if id == 0 {
+		slog.Info("Evicted cached lyrics without lrclib id", "title", info.Title, "artist", info.Artist)
+		if _, err := GetLyrics(info); err != nil {
+			return 0, fmt.Errorf("%w: evicted the cache, fetching lyrics again failed: %w", ErrNoLrclibID, err)
+		}
+		return 0, fmt.Errorf("%w: evicted the cache and fetched lyrics again, flag again if they are still wrong", ErrNoLrclibID)
+	}
+	slog.Info("Flagged lyrics as wrong", "lrclib-id", id, "title", info.Title, "artist", info.Artist)
+
+	_, err = GetLyrics(info)
+	return id, err
+}
+
+// recoverID finds lrclib id of cached lyrics without the id by looking up the
+// track the same way as fetching and comparing the lyrics
+func recoverID(key string, info *player.Info) (int, error) {
+	cached, err := LoadCache(CachePath(key))
+	if err != nil {
+		return 0, err
+	}
+
+	query := Query(info)
+	res, err := lookup(query)
+	if err == nil {
+		if id, ok := matchingID(cached, []LrcLibResponse{*res}); ok {
+			return id, nil
+		}
+	}
+
+	candidates, err := Candidates(query)
+	if err != nil {
+		return 0, err
+	}
+	if id, ok := matchingID(cached, candidates); ok {
+		return id, nil
+	}
+
+	return 0, ErrLyricsNotFound
+}
+
+// matchingID returns lrclib id of the first response with the same synced
+// lyrics as cached
+func matchingID(cached shared.Lyrics, responses []LrcLibResponse) (int, bool) {
+	for res := range slices.Values(responses) {
+		lyrics, err := res.Lyrics()
+		if err != nil {
+			continue
+		}
+		if changed, retimed := diffLyrics(cached, lyrics); changed == 0 && retimed == 0 {
+			return res.ID, true
+		}
+	}
+	return 0, false
+}
+
+// evict adds the cached lrclib id to the denylist and removes the cache. If
+// the cache has no lrclib id, recovered is denylisted instead unless it's zero.
+// It returns the denylisted id or zero.
+func evict(key string, recovered int) (int, error) {
+	unlock := Lock(key)
+	defer unlock()
+
+	id, err := CachedID(key)
+	if errors.Is(err, ErrNoLrclibID) {
+		id, err = recovered, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if id != 0 {
+		ids, err := Denylist(key)
+		if err != nil {
+			return 0, err
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+		if err := saveDenylist(key, ids); err != nil {
+			return 0, fmt.Errorf("failed to save denylist: %w", err)
+		}
+	}
+
+	if err := os.Remove(CachePath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to evict cache: %w", err)
+	}
+	Store.Delete(key)
+
+	return id, nil
+}
+
+// Pin binds lrclib lyrics with given id to the track. Pinned lyrics replace
+// the cache and are revalidated by id.
+func Pin(info *player.Info, id int) error {
+	key := CacheKey(info)
+
+	res, err := FetchID(id)
+	if err != nil {
+		return err
+	}
+
+	lyrics, err := res.Lyrics()
+	if err != nil {
+		return err
+	}
+
+	unlock := Lock(key)
+	defer unlock()
+
+	ids, err := Denylist(key)
+	if err != nil {
+		return err
+	}
+	if slices.Contains(ids, id) {
+		ids = slices.DeleteFunc(ids, func(v int) bool { return v == id })
+		if err := saveDenylist(key, ids); err != nil {
+			return fmt.Errorf("failed to save denylist: %w", err)
+		}
+	}
+
+	header := append(cacheHeader(info),
+		headerLine(headerQuery, Query(info).Encode()),
+		headerLine(headerLrclibID, strconv.Itoa(res.ID)),
+		headerLine(headerPinned, "true"),
+	)
+	if err := writeCache(CachePath(key), header, lyrics); err != nil {
+		return fmt.Errorf("failed to cache lyrics to psudo csv: %w", err)
+	}
+	Store.Delete(key)
+
+	slog.Info("Pinned lyrics", "lrclib-id", res.ID, "title", info.Title, "artist", info.Artist)
+	return nil
+}
+
+// Candidates searches lrclib candidates for given query parameters. Synced
+// candidates closest to the queried duration are sorted first.
+func Candidates(query url.Values) ([]LrcLibResponse, error) {
+	search := url.Values{}
+	for _, key := range []string{"q", "track_name", "artist_name"} {
+		if v := query.Get(key); v != "" {
+			search.Set(key, v)
+		}
+	}
+
+	candidates, err := Search(search)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, _ := strconv.ParseFloat(query.Get("duration"), 64)
+	slices.SortStableFunc(candidates, func(a, b LrcLibResponse) int {
+		aSynced, bSynced := a.SyncedLyrics != "", b.SyncedLyrics != ""
+		if aSynced != bSynced {
+			if aSynced {
+				return -1
+			}
+			return 1
+		}
+		if duration == 0 {
+			return 0
+		}
+		return cmp.Compare(math.Abs(a.Duration-duration), math.Abs(b.Duration-duration))
+	})
+
+	return candidates, nil
+}
+
+// MaxDurationDiff is the maximum difference in seconds between track length
+// and candidate duration, same as lrclib uses for matching
+const MaxDurationDiff = 2
+
+// nextCandidate returns the best synced search candidate which is not flagged
+// as wrong for given cache key
+func nextCandidate(key string, query url.Values) (*LrcLibResponse, error) {
+	candidates, err := Candidates(query)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := Denylist(key)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, _ := strconv.ParseFloat(query.Get("duration"), 64)
+	for c := range slices.Values(candidates) {
+		if c.SyncedLyrics == "" || slices.Contains(ids, c.ID) {
+			continue
+		}
+		if duration != 0 && math.Abs(c.Duration-duration) > MaxDurationDiff {
+			continue
+		}
+		slog.Info("Selected next lyrics candidate", "lrclib-id", c.ID)
+		return &c, nil
+	}
+
+	return nil, ErrLyricsNotFound
+}
@@ -0,0 +1,84 @@
+package lyric
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+func TestEvict_NoLrclibID(t *testing.T) {
+	CacheDir = t.TempDir()
+	info := &player.Info{Player: "org.mpris.MediaPlayer2.test", ID: "test-id"}
+	key := CacheKey(info)
+	lyrics := shared.Lyrics{{Timestamp: time.Second, Text: "Hello, world"}}
+
+	tests := []struct {
+		name      string
+		recovered int
+		denylist  []int
+	}{
+		{"unrecovered", 0, nil},
+		{"recovered", 42, []int{42}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Caches written before lrclib ids were recorded only have
+			// player info in the header
+			if err := SaveCache(info, lyrics, CachePath(key)); err != nil {
+				t.Fatalf("SaveCache() failed: %v", err)
+			}
+			t.Cleanup(func() { os.Remove(DenylistPath(key)) })
+
+			if _, err := CachedID(key); !errors.Is(err, ErrNoLrclibID) {
+				t.Fatalf("CachedID() error = %v, want ErrNoLrclibID", err)
+			}
+
+			id, err := evict(key, tt.recovered)
+			if err != nil {
+				t.Fatalf("evict() failed: %v", err)
+			}
+			if id != tt.recovered {
+				t.Errorf("evict() = %d, want %d", id, tt.recovered)
+			}
+			if _, err := os.Stat(CachePath(key)); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("evict() kept the cache: %v", err)
+			}
+
+			ids, err := Denylist(key)
+			if err != nil {
+				t.Fatalf("Denylist() failed: %v", err)
+			}
+			if !slices.Equal(ids, tt.denylist) {
+				t.Errorf("Denylist() = %v, want %v", ids, tt.denylist)
+			}
+		})
+	}
+}
+
+func TestMatchingID(t *testing.T) {
+	cached := shared.Lyrics{
+		{},
+		{Timestamp: time.Second, Text: "Hello"},
+		{Timestamp: 2 * time.Second, Text: "World"},
+	}
+	responses := []LrcLibResponse{
+		{ID: 1, PlainLyrics: "Hello\nWorld"},
+		{ID: 2, SyncedLyrics: "[00:01.00] Hello\n[00:02.50] World"},
+		{ID: 3, SyncedLyrics: "[00:01.00] Hello\n[00:02.00] World"},
+	}
+
+	id, ok := matchingID(cached, responses)
+	if !ok || id != 3 {
+		t.Errorf("matchingID() = %d, %t, want 3, true", id, ok)
+	}
+
+	if id, ok := matchingID(cached, responses[:2]); ok {
+		t.Errorf("matchingID() = %d, want no match", id)
+	}
+}
@@ -0,0 +1,137 @@
+package lyric
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/Nadim147c/waybar-lyric/internal/config"
+)
+
+// SQLiteCommand is the sqlite3 executable used to query lrclib dumps. It must
+// be installed to use --lrclib-db.
+const SQLiteCommand = "sqlite3"
+
+// ValidateDump checks if the lrclib dump at dbPath can be queried. Empty path
+// disables the dump.
+func ValidateDump(dbPath string) error {
+	if dbPath == "" {
+		return nil
+	}
+	if _, err := exec.LookPath(SQLiteCommand); err != nil {
+		return fmt.Errorf("--lrclib-db requires %s to be installed: %w", SQLiteCommand, err)
+	}
+	return nil
+}
+
+// Normalize prepares track, artist and album names for matching the same way
+// lrclib fills its lowercase columns
+func Normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// dumpQuery is the SQL query for a lrclib database dump. It matches normalized
+// track and artist names and duration within MaxDurationDiff seconds,
+// preferring album matches and synced lyrics. Duration is ignored when it's 0.
+const dumpQuery = `SELECT
+	t.id AS id,
+	t.name AS trackName,
+	t.artist_name AS artistName,
+	t.album_name AS albumName,
+	t.duration AS duration,
+	l.plain_lyrics AS plainLyrics,
+	l.synced_lyrics AS syncedLyrics
+FROM tracks t JOIN lyrics l ON l.id = t.last_lyrics_id
+WHERE t.name_lower = @track AND t.artist_name_lower = @artist
+AND (@duration = 0 OR t.duration BETWEEN @duration - @diff AND @duration + @diff)
+ORDER BY t.album_name_lower = @album DESC, l.has_synced_lyrics DESC, ABS(t.duration - @duration)
+LIMIT 1;
+`
+
+// dumpScript returns the sqlite3 shell input querying the dump. Query values
+// are bound as parameters, text is passed as hex blobs so it never reaches
+// the SQL or shell parser.
+func dumpScript(query url.Values) string {
+	duration, _ := strconv.ParseFloat(query.Get("duration"), 64)
+	if math.IsNaN(duration) || math.IsInf(duration, 0) {
+		duration = 0
+	}
+
+	var script strings.Builder
+	setText := func(name, value string) {
+		fmt.Fprintf(&script, ".parameter set %s \"CAST(X'%s' AS TEXT)\"\n", name, hex.EncodeToString([]byte(value)))
+	}
+	setText("@track", Normalize(query.Get("track_name")))
+	setText("@artist", Normalize(query.Get("artist_name")))
+	setText("@album", Normalize(query.Get("album_name")))
+	fmt.Fprintf(&script, ".parameter set @duration %.2f\n", duration)
+	fmt.Fprintf(&script, ".parameter set @diff %d\n", MaxDurationDiff)
+	script.WriteString(dumpQuery)
+	return script.String()
+}
+
+// QueryDump queries a local lrclib SQLite database dump with lrclib query
+// parameters. It returns ErrLyricsNotFound if the dump doesn't have the track.
+func QueryDump(dbPath string, query url.Values) (*LrcLibResponse, error) {
+	cmd := exec.Command(SQLiteCommand, "-readonly", "-json", dbPath)
+	cmd.Stdin = strings.NewReader(dumpScript(query))
+
+	slog.Info("Querying lyrics from lrclib dump", "db", dbPath, "title", query.Get("track_name"))
+
+	output, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return nil, fmt.Errorf("failed to query lrclib dump: %s", strings.TrimSpace(string(exitErr.Stderr)))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query lrclib dump: %w", err)
+	}
+
+	// sqlite3 prints nothing for empty results
+	if len(strings.TrimSpace(string(output))) == 0 {
+		return nil, ErrLyricsNotFound
+	}
+
+	var rows []LrcLibResponse
+	if err := json.Unmarshal(output, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode lrclib dump result: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrLyricsNotFound
+	}
+
+	return &rows[0], nil
+}
+
+// lookup fetches lyrics from the local lrclib dump when configured and falls
+// back to lrclib api if the dump doesn't have the track. If lrclib can't be
+// reached either, a dump miss is returned as ErrLyricsNotFound, so it's cached
+// like lrclib misses instead of querying the dump again on every update.
+func lookup(query url.Values) (*LrcLibResponse, error) {
+	if config.LrclibDB == "" {
+		return Fetch(query)
+	}
+
+	res, err := QueryDump(config.LrclibDB, query)
+	if err == nil {
+		return res, nil
+	}
+	missed := errors.Is(err, ErrLyricsNotFound)
+	if !missed {
+		slog.Warn("Failed to find lyrics in lrclib dump", "error", err)
+	}
+
+	res, err = Fetch(query)
+	if missed && errors.Is(err, ErrLrclibUnreachable) {
+		slog.Debug("Lyrics are not in lrclib dump and lrclib is unreachable", "error", err)
+		return nil, ErrLyricsNotFound
+	}
+	return res, err
+}
@@ -0,0 +1,84 @@
+package lyric
+
+import (
+	"errors"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testDump = `
+CREATE TABLE tracks (
+	id INTEGER PRIMARY KEY, name TEXT, name_lower TEXT, artist_name TEXT,
+	artist_name_lower TEXT, album_name TEXT, album_name_lower TEXT,
+	duration FLOAT, last_lyrics_id INTEGER
+);
+CREATE TABLE lyrics (
+	id INTEGER PRIMARY KEY, plain_lyrics TEXT, synced_lyrics TEXT,
+	track_id INTEGER, has_plain_lyrics BOOLEAN, has_synced_lyrics BOOLEAN,
+	instrumental BOOLEAN
+);
+INSERT INTO tracks VALUES (1, 'Don''t Stop', 'don''t stop', 'Band', 'band', 'Live', 'live', 200, 1);
+INSERT INTO tracks VALUES (2, 'Don''t Stop', 'don''t stop', 'Band', 'band', 'Album', 'album', 201, 2);
+INSERT INTO tracks VALUES (3, 'Don''t Stop', 'don''t stop', 'Band', 'band', 'Album', 'album', 300, 3);
+INSERT INTO lyrics VALUES (1, 'Plain', NULL, 1, 1, 0, 0);
+INSERT INTO lyrics VALUES (2, 'Plain', '[00:01.00]Synced', 2, 1, 1, 0);
+INSERT INTO lyrics VALUES (3, 'Plain', '[00:01.00]Long', 3, 1, 1, 0);
+`
+
+func TestQueryDump(t *testing.T) {
+	if _, err := exec.LookPath(SQLiteCommand); err != nil {
+		t.Skip("sqlite3 is not installed")
+	}
+
+	dbPath := filepath.Join(t.TempDir(), "lrclib.sqlite3")
+	cmd := exec.Command(SQLiteCommand, dbPath)
+	cmd.Stdin = strings.NewReader(testDump)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Failed to create dump: %v: %s", err, out)
+	}
+
+	query := url.Values{}
+	query.Set("track_name", "  DON'T   Stop ")
+	query.Set("artist_name", "band")
+	query.Set("album_name", "Album")
+	query.Set("duration", "200.40")
+
+	res, err := QueryDump(dbPath, query)
+	if err != nil {
+		t.Fatalf("QueryDump() failed: %v", err)
+	}
+	if res.ID != 2 || res.SyncedLyrics != "[00:01.00]Synced" {
+		t.Errorf("QueryDump() = %+v, want track 2", res)
+	}
+
+	query.Set("duration", "250")
+	if _, err := QueryDump(dbPath, query); !errors.Is(err, ErrLyricsNotFound) {
+		t.Errorf("QueryDump() with wrong duration error = %v, want ErrLyricsNotFound", err)
+	}
+
+	// Names are bound as parameters, not pasted into the query
+	query.Set("duration", "0")
+	query.Set("track_name", "x' OR 1=1 OR '")
+	if _, err := QueryDump(dbPath, query); !errors.Is(err, ErrLyricsNotFound) {
+		t.Errorf("QueryDump() with quoted name error = %v, want ErrLyricsNotFound", err)
+	}
+}
+
+func TestValidateDump(t *testing.T) {
+	if err := ValidateDump(""); err != nil {
+		t.Errorf("ValidateDump() without dump = %v", err)
+	}
+
+	_, lookErr := exec.LookPath(SQLiteCommand)
+	if err := ValidateDump("lrclib.sqlite3"); (err == nil) != (lookErr == nil) {
+		t.Errorf("ValidateDump() = %v, sqlite3 lookup error = %v", err, lookErr)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if err := ValidateDump("lrclib.sqlite3"); err == nil {
+		t.Error("ValidateDump() without sqlite3 succeeded")
+	}
+}
@@ -0,0 +1,48 @@
+package lyric
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// errLocked is returned by tryLock when the lock is held by another process
+var errLocked = errors.New("lock is held by another process")
+
+// LockTimeout is the maximum time to wait for another process to release the
+// lock of a cache key
+const LockTimeout = 30 * time.Second
+
+// Lock takes an advisory lock for given cache key, shared across processes,
+// and returns a function to release it. If the lock can't be taken within
+// LockTimeout the caller continues without it.
+func Lock(key string) func() {
+	lockPath := filepath.Join(CacheDir, key+".lock")
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		slog.Warn("Failed to open cache lock", "file", lockPath, "error", err)
+		return func() {}
+	}
+
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		err := tryLock(file)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, errLocked) || time.Now().After(deadline) {
+			slog.Warn("Failed to lock cache", "file", lockPath, "error", err)
+			file.Close()
+			return func() {}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	slog.Debug("Locked cache", "key", key)
+	return func() {
+		unlock(file)
+		file.Close()
+	}
+}
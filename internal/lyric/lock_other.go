@@ -0,0 +1,10 @@
+//go:build !unix
+
+package lyric
+
+import "os"
+
+// Advisory file locks are not supported, every process fetches on its own.
+func tryLock(_ *os.File) error { return nil }
+
+func unlock(_ *os.File) error { return nil }
@@ -7,8 +7,10 @@ import (
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -34,9 +36,10 @@ type LrcLibResponse struct {
 
 var (
 	//revive:disable
-	ErrLyricsNotFound  = errors.New("lyrics not found")
-	ErrLyricsNotExists = errors.New("lyrics does not exists")
-	ErrLyricsNotSynced = errors.New("lyrics is not synced")
+	ErrLyricsNotFound    = errors.New("lyrics not found")
+	ErrLyricsNotExists   = errors.New("lyrics does not exists")
+	ErrLyricsNotSynced   = errors.New("lyrics is not synced")
+	ErrLrclibUnreachable = errors.New("failed to reach lrclib")
 	//revive:enable
 )
 
@@ -44,10 +47,106 @@ var (
 var Store = newStore()
 
 // LrclibEndpoint is api endpoint for lrclib
-const LrclibEndpoint = "https://lrclib.net/api/get"
+var LrclibEndpoint = "https://lrclib.net/api/get"
 
-func request(params url.Values, header http.Header) (*http.Response, error) {
-	req, err := http.NewRequest(http.MethodGet, LrclibEndpoint, nil)
+// LrclibSearchEndpoint is search api endpoint for lrclib
+var LrclibSearchEndpoint = "https://lrclib.net/api/search"
+
+// RequestTimeout is the maximum time of a lrclib request. It's below
+// LockTimeout, so processes waiting for a fetching process don't time out.
+const RequestTimeout = 10 * time.Second
+
+// CheckInterval is the minimum time between checks of a cache file for
+// lyrics written by another process
+const CheckInterval = time.Second
+
+// Query returns lrclib query parameters for given *player.Info
+func Query(info *player.Info) url.Values {
+	queryParams := url.Values{}
+	queryParams.Set("track_name", info.Title)
+	queryParams.Set("artist_name", info.Artist)
+	if info.Album != "" {
+		queryParams.Set("album_name", info.Album)
+	}
+	if info.Length != 0 {
+		queryParams.Set("duration", fmt.Sprintf("%.2f", info.Length.Seconds()))
+	}
+	return queryParams
+}
+
+// Fetch fetches lyrics from lrclib for given query parameters
+func Fetch(query url.Values) (*LrcLibResponse, error) {
+	var res LrcLibResponse
+	if err := lrclib(LrclibEndpoint, query, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// FetchID fetches lyrics from lrclib by lrclib id
+func FetchID(id int) (*LrcLibResponse, error) {
+	var res LrcLibResponse
+	if err := lrclib(LrclibEndpoint+"/"+strconv.Itoa(id), nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Search searches lrclib for lyrics candidates of given query parameters
+func Search(query url.Values) ([]LrcLibResponse, error) {
+	var res []LrcLibResponse
+	if err := lrclib(LrclibSearchEndpoint, query, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// lrclib requests lrclib api endpoint and decodes the response into v
+func lrclib(endpoint string, query url.Values, v any) error {
+	header := http.Header{}
+	header.Set("User-Agent", config.Version)
+
+	resp, err := request(endpoint, query, header)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLrclibUnreachable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrLyricsNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return nil
+}
+
+// Lyrics returns sorted synced lyrics of the response
+func (r *LrcLibResponse) Lyrics() (shared.Lyrics, error) {
+	lyrics, err := ParseLyrics(r.SyncedLyrics)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse lyrics: %w", err)
+	}
+
+	if len(lyrics) == 0 {
+		return nil, ErrLyricsNotSynced
+	}
+
+	slices.SortFunc(lyrics, func(a, b shared.LyricLine) int {
+		return int((a.Timestamp - b.Timestamp) / time.Millisecond)
+	})
+
+	return lyrics, nil
+}
+
+func request(endpoint string, params url.Values, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -57,7 +156,7 @@ func request(params url.Values, header http.Header) (*http.Response, error) {
 
 	slog.Info("Fetching lyrics from Lrclib", "url", req.URL.String())
 
-	client := http.Client{}
+	client := http.Client{Timeout: RequestTimeout}
 
 	return client.Do(req)
 }
@@ -87,92 +186,146 @@ func SimplifyLyrics(lyrics shared.Lyrics) {
 	}
 }
 
-// GetLyrics returns lyrics for given *player.Info
-func GetLyrics(info *player.Info) (shared.Lyrics, error) {
+// CacheKey returns the key used to cache lyrics of given *player.Info
+func CacheKey(info *player.Info) string {
 	uri := filepath.Base(info.ID)
-	uri = strings.ReplaceAll(uri, "/", "-")
+	return strings.ReplaceAll(uri, "/", "-")
+}
 
-	if val, exists := Store.Load(uri); exists {
-		if len(val) == 0 {
-			return val, ErrLyricsNotExists
+// GetLyrics returns lyrics for given *player.Info with the persisted timing
+// offset of the track applied. The offset is loaded once with the lyrics, use
+// ReloadOffset when it changes.
+func GetLyrics(info *player.Info) (shared.Lyrics, error) {
+	uri := CacheKey(info)
+
+	lyrics, err := getLyrics(info, uri)
+	if err != nil {
+		return lyrics, err
+	}
+
+	offset, ok := Store.Offset(uri)
+	if !ok {
+		offset, err = LoadOffset(uri)
+		if err != nil {
+			slog.Warn("Failed to load lyrics offset", "error", err)
 		}
-		slog.Debug("Lyrics found in memory cache", "lines", len(val))
-		return val, nil
+		Store.SaveOffset(uri, offset)
 	}
 
-	cacheFile := filepath.Join(CacheDir, uri+".csv")
+	return Shift(lyrics, offset), nil
+}
 
-	cachedLyrics, err := LoadCache(cacheFile)
-	if err == nil {
-		CensorLyrics(cachedLyrics)
-		SimplifyLyrics(cachedLyrics)
-		Store.Save(uri, cachedLyrics)
-		return cachedLyrics, nil
-	}
-	slog.Warn("Can't find the lyrics in the cache", "error", err)
+// ReloadOffset makes the next GetLyrics load the persisted timing offset of
+// the track again
+func ReloadOffset(info *player.Info) {
+	Store.ForgetOffset(CacheKey(info))
+}
 
-	w := waybar.ForPlayer(info)
-	w.Alt = waybar.Getting
-	w.Class = append(w.Class, waybar.Getting)
-	w.Encode()
+// errCacheMiss is returned by loadCache when lyrics must be fetched
+var errCacheMiss = errors.New("lyrics cache miss")
 
-	queryParams := url.Values{}
-	queryParams.Set("track_name", info.Title)
-	queryParams.Set("artist_name", info.Artist)
-	if info.Album != "" {
-		queryParams.Set("album_name", info.Album)
+// loadCache loads lyrics from the cache file into memory cache. Corrupt cache
+// files are quarantined.
+func loadCache(uri, cacheFile string) (shared.Lyrics, error) {
+	cachedLyrics, err := LoadCache(cacheFile)
+	if errors.Is(err, ErrLyricsNotExists) && config.RevalidateDays > 0 {
+		slog.Debug("Lyrics are cached as missing", "file", cacheFile)
+		Store.SaveFile(uri, shared.Lyrics{}, modTime(cacheFile))
+		return nil, err
 	}
-	if info.Length != 0 {
-		queryParams.Set("duration", fmt.Sprintf("%.2f", info.Length.Seconds()))
+	if err != nil {
+		slog.Warn("Can't find the lyrics in the cache", "error", err)
+		if errors.Is(err, ErrCorruptCache) {
+			quarantine(cacheFile)
+		}
+		return nil, errCacheMiss
 	}
 
-	header := http.Header{}
-	header.Set("User-Agent", config.Version)
+	CensorLyrics(cachedLyrics)
+	SimplifyLyrics(cachedLyrics)
+	Store.SaveFile(uri, cachedLyrics, modTime(cacheFile))
+	return cachedLyrics, nil
+}
 
-	resp, err := request(queryParams, header)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch lyrics: %w", err)
+// CachePath returns path of the lyrics cache file for given cache key
+func CachePath(key string) string {
+	return filepath.Join(CacheDir, key+".csv")
+}
+
+func getLyrics(info *player.Info, uri string) (shared.Lyrics, error) {
+	cacheFile := CachePath(uri)
+
+	// Cache file is modified when another process fetches, flags or pins
+	// lyrics of the track. It's checked at most once per CheckInterval.
+	val, exists := Store.LoadChecked(uri, CheckInterval)
+	if !exists {
+		val, exists = Store.LoadFile(uri, modTime(cacheFile))
+	}
+	if exists {
+		if len(val) == 0 {
+			return val, ErrLyricsNotExists
+		}
+		slog.Debug("Lyrics found in memory cache", "lines", len(val))
+		return val, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		Store.Save(uri, shared.Lyrics{})
-		return nil, ErrLyricsNotFound
+	if err := addQuery(info, uri); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to add lrclib query to cache", "error", err)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		Store.Save(uri, shared.Lyrics{})
-		return nil, fmt.Errorf("unexpected HTTP status: %d", resp.StatusCode)
+	if cachedLyrics, err := loadCache(uri, cacheFile); !errors.Is(err, errCacheMiss) {
+		return cachedLyrics, err
 	}
 
-	var resJSON LrcLibResponse
-	err = json.NewDecoder(resp.Body).Decode(&resJSON)
-	if err != nil {
-		Store.Save(uri, shared.Lyrics{})
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+	// Only one process fetches lyrics for a track. Others wait for the lock
+	// and read the cache written by it. Requests time out well before the
+	// lock, so waiters don't give up on a hung request.
+	unlock := Lock(uri)
+	defer unlock()
+
+	if cachedLyrics, err := loadCache(uri, cacheFile); !errors.Is(err, errCacheMiss) {
+		return cachedLyrics, err
 	}
 
-	lyrics, err := ParseLyrics(resJSON.SyncedLyrics)
-	if err != nil {
-		Store.Save(uri, shared.Lyrics{})
-		return nil, fmt.Errorf("failed to parse lyrics: %w", err)
+	w := waybar.ForPlayer(info)
+	w.Alt = waybar.Getting
+	w.Class = append(w.Class, waybar.Getting)
+	w.Encode()
+
+	query := Query(info)
+	res, err := lookup(query)
+	if err == nil && IsDenied(uri, res.ID) {
+		slog.Info("Lrclib match is flagged as wrong, searching other candidates", "lrclib-id", res.ID)
+		res, err = nextCandidate(uri, query)
+	}
+	if errors.Is(err, ErrLrclibUnreachable) {
+		return nil, err
 	}
 
-	if len(lyrics) == 0 {
+	var lyrics shared.Lyrics
+	if err == nil {
+		lyrics, err = res.Lyrics()
+	}
+	if err != nil {
 		Store.Save(uri, shared.Lyrics{})
-		return nil, ErrLyricsNotSynced
+		if config.RevalidateDays > 0 && (errors.Is(err, ErrLyricsNotFound) || errors.Is(err, ErrLyricsNotSynced)) {
+			// Remember missing lyrics on disk so they can be revalidated later
+			header := append(cacheHeader(info), headerLine(headerQuery, query.Encode()), headerLine(headerStatus, statusNotFound))
+			if err := writeCache(cacheFile, header, nil); err != nil {
+				slog.Warn("Failed to cache missing lyrics", "error", err)
+			}
+			Store.SaveFile(uri, shared.Lyrics{}, modTime(cacheFile))
+		}
+		return nil, err
 	}
 
-	slices.SortFunc(lyrics, func(a, b shared.LyricLine) int {
-		return int((a.Timestamp - b.Timestamp) / time.Millisecond)
-	})
-
-	if err = SaveCache(info, lyrics, cacheFile); err != nil {
+	header := append(cacheHeader(info), headerLine(headerQuery, query.Encode()), headerLine(headerLrclibID, strconv.Itoa(res.ID)))
+	if err = writeCache(cacheFile, header, lyrics); err != nil {
 		return nil, fmt.Errorf("failed to cache lyrics to psudo csv: %w", err)
 	}
 
 	CensorLyrics(lyrics)
 	SimplifyLyrics(lyrics)
-	Store.Save(uri, lyrics)
+	Store.SaveFile(uri, lyrics, modTime(cacheFile))
 	return lyrics, nil
 }
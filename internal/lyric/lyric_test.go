@@ -0,0 +1,51 @@
+package lyric
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+)
+
+func TestGetLyrics_FetchesOnce(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		time.Sleep(200 * time.Millisecond) // Keep the other request waiting
+		json.NewEncoder(w).Encode(LrcLibResponse{
+			ID:           1,
+			SyncedLyrics: "[00:01.00] Hello\n[00:02.00] World",
+		})
+	}))
+	defer server.Close()
+
+	endpoint := LrclibEndpoint
+	LrclibEndpoint = server.URL
+	t.Cleanup(func() { LrclibEndpoint = endpoint })
+
+	CacheDir = t.TempDir()
+	Store = newStore()
+	info := &player.Info{Player: "org.mpris.MediaPlayer2.test", ID: "test-id", Title: "Song", Artist: "Artist", Length: time.Minute}
+
+	var wg sync.WaitGroup
+	for range 2 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lyrics, err := getLyrics(info, CacheKey(info))
+			if err != nil || len(lyrics) != 3 {
+				t.Errorf("getLyrics() = %v, %v, want 3 lines", lyrics, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("Lrclib was requested %d times, want once", n)
+	}
+}
@@ -0,0 +1,74 @@
+package lyric
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+// OffsetState is the name of the state file saved by the offset command, so
+// running instances apply the new offset immediately
+const OffsetState = "offset"
+
+// OffsetPath returns the path of the offset file for given cache key. The
+// offset file lives next to the lyrics cache file of the track.
+func OffsetPath(key string) string {
+	return filepath.Join(CacheDir, key+".offset")
+}
+
+// LoadOffset loads the persisted timing offset for given cache key. It returns
+// zero if no offset has been saved for the track.
+func LoadOffset(key string) (time.Duration, error) {
+	content, err := os.ReadFile(OffsetPath(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err := time.ParseDuration(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid offset file: %w", err)
+	}
+
+	return offset, nil
+}
+
+// SaveOffset persists the timing offset for given cache key. Saving a zero
+// offset removes the offset file.
+func SaveOffset(key string, offset time.Duration) error {
+	filePath := OffsetPath(key)
+	if offset == 0 {
+		err := os.Remove(filePath)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return writeAtomic(filePath, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, offset)
+		return err
+	})
+}
+
+// Shift returns a copy of lyrics where every timestamp is moved by offset. A
+// positive offset makes lyrics appear later, a negative offset earlier.
+func Shift(lyrics shared.Lyrics, offset time.Duration) shared.Lyrics {
+	if offset == 0 {
+		return lyrics
+	}
+
+	shifted := slices.Clone(lyrics)
+	for i := range shifted {
+		shifted[i].Timestamp = max(0, shifted[i].Timestamp+offset)
+	}
+	return shifted
+}
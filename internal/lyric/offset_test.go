@@ -0,0 +1,94 @@
+package lyric
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+func TestShift(t *testing.T) {
+	lyrics := shared.Lyrics{
+		{Timestamp: 0},
+		{Timestamp: 200 * time.Millisecond, Text: "First"},
+		{Timestamp: 5 * time.Second, Text: "Second"},
+	}
+
+	later := Shift(lyrics, 500*time.Millisecond)
+	if later[1].Timestamp != 700*time.Millisecond || later[2].Timestamp != 5500*time.Millisecond {
+		t.Errorf("Shift() with positive offset = %v", later)
+	}
+
+	earlier := Shift(lyrics, -300*time.Millisecond)
+	if earlier[0].Timestamp != 0 || earlier[1].Timestamp != 0 || earlier[2].Timestamp != 4700*time.Millisecond {
+		t.Errorf("Shift() with negative offset = %v", earlier)
+	}
+
+	if lyrics[1].Timestamp != 200*time.Millisecond {
+		t.Error("Shift() modified the original lyrics")
+	}
+}
+
+func TestOffset_SaveLoad(t *testing.T) {
+	CacheDir = t.TempDir()
+	key := "test-key"
+
+	offset, err := LoadOffset(key)
+	if err != nil || offset != 0 {
+		t.Fatalf("LoadOffset() without file = %v, %v", offset, err)
+	}
+
+	if err := SaveOffset(key, -350*time.Millisecond); err != nil {
+		t.Fatalf("SaveOffset() failed: %v", err)
+	}
+	offset, err = LoadOffset(key)
+	if err != nil || offset != -350*time.Millisecond {
+		t.Errorf("LoadOffset() = %v, %v; want -350ms", offset, err)
+	}
+
+	if err := SaveOffset(key, 0); err != nil {
+		t.Fatalf("SaveOffset() with zero failed: %v", err)
+	}
+	offset, err = LoadOffset(key)
+	if err != nil || offset != 0 {
+		t.Errorf("LoadOffset() after reset = %v, %v; want 0", offset, err)
+	}
+}
+
+func TestGetLyrics_CachedOffset(t *testing.T) {
+	CacheDir = t.TempDir()
+	Store = newStore()
+	info := &player.Info{Player: "org.mpris.MediaPlayer2.test", ID: "test-id"}
+	key := CacheKey(info)
+	lyrics := shared.Lyrics{{}, {Timestamp: time.Second, Text: "Hello"}}
+	if err := SaveCache(info, lyrics, CachePath(key)); err != nil {
+		t.Fatalf("SaveCache() failed: %v", err)
+	}
+
+	timestamp := func() time.Duration {
+		t.Helper()
+		got, err := GetLyrics(info)
+		if err != nil {
+			t.Fatalf("GetLyrics() failed: %v", err)
+		}
+		return got[1].Timestamp
+	}
+
+	if got := timestamp(); got != time.Second {
+		t.Fatalf("GetLyrics() without offset = %v, want 1s", got)
+	}
+
+	// Offset is loaded with the lyrics, not on every call
+	if err := SaveOffset(key, 500*time.Millisecond); err != nil {
+		t.Fatalf("SaveOffset() failed: %v", err)
+	}
+	if got := timestamp(); got != time.Second {
+		t.Errorf("GetLyrics() before ReloadOffset() = %v, want 1s", got)
+	}
+
+	ReloadOffset(info)
+	if got := timestamp(); got != 1500*time.Millisecond {
+		t.Errorf("GetLyrics() after ReloadOffset() = %v, want 1.5s", got)
+	}
+}
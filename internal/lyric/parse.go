@@ -47,6 +47,30 @@ func ParseLyrics(file string) (shared.Lyrics, error) {
 	return lyrics, nil
 }
 
+// ParseTags parses ID tags of a LRC file, e.g. [ti:Title], [ar:Artist] or
+// [length:3:20]. Tag names are lower cased.
+func ParseTags(file string) map[string]string {
+	tags := map[string]string{}
+	for line := range strings.SplitSeq(file, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line[1:len(line)-1], ":")
+		key = strings.ToLower(strings.TrimSpace(key))
+		if !ok || key == "" {
+			continue
+		}
+		if _, err := strconv.ParseFloat(key, 64); err == nil {
+			continue // Timestamp of an empty lyrics line
+		}
+
+		tags[key] = strings.TrimSpace(value)
+	}
+	return tags
+}
+
 // ParseTimestamp converts a timestamp string (in "HH:MM:SS", "MM:SS" or "SS" format)
 // into a time.Duration value representing the total number of nanoseconds.
 // Example inputs: "1:30:45" (1h 30m 45s), "5:20" (5m 20s), "42" (42s)
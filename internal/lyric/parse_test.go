@@ -206,3 +206,18 @@ func TestParseLyrics(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTags(t *testing.T) {
+	file := "[ti: Song Title ]\n[AR:Artist]\n[length:3:20]\n[00:05.00]\n[00:06.00]First line\n[by:]\nplain text"
+	want := map[string]string{
+		"ti":     "Song Title",
+		"ar":     "Artist",
+		"length": "3:20",
+		"by":     "",
+	}
+
+	got := ParseTags(file)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseTags() = %v, want %v", got, want)
+	}
+}
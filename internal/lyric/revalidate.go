@@ -0,0 +1,280 @@
+package lyric
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+// RevalidateInterval is the time between two revalidation requests to lrclib
+const RevalidateInterval = time.Minute
+
+// missingMaxAge is the age after which lyrics cached as missing are checked
+// again, unless the configured age is shorter
+const missingMaxAge = 24 * time.Hour
+
+// Revalidate runs a blocking loop that re-checks the oldest cache entry older
+// than maxAge with lrclib every RevalidateInterval until the context is
+// canceled. Entries cached as missing are checked again after a day.
+func Revalidate(ctx context.Context, maxAge time.Duration) {
+	ticker := time.NewTicker(RevalidateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return // Exit when context is canceled
+		case <-ticker.C:
+		}
+
+		filePath, ok := staleCache(maxAge)
+		if !ok {
+			continue
+		}
+
+		if err := revalidate(filePath); err != nil {
+			slog.Warn("Failed to revalidate lyrics", "file", filePath, "error", err)
+		}
+	}
+}
+
+// staleCache returns the oldest cache file which should be revalidated
+func staleCache(maxAge time.Duration) (string, bool) {
+	entries, err := os.ReadDir(CacheDir)
+	if err != nil {
+		slog.Warn("Failed to read cache directory", "error", err)
+		return "", false
+	}
+
+	type candidate struct {
+		path    string
+		modTime time.Time
+	}
+
+	var candidates []candidate
+	for entry := range slices.Values(entries) {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".csv" {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(stat.ModTime()) < min(maxAge, missingMaxAge) {
+			continue
+		}
+		candidates = append(candidates, candidate{
+			path:    filepath.Join(CacheDir, entry.Name()),
+			modTime: stat.ModTime(),
+		})
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	for c := range slices.Values(candidates) {
+		if time.Since(c.modTime) >= maxAge {
+			return c.path, true
+		}
+		header, err := ReadHeader(c.path)
+		if err == nil && header[headerStatus] == statusNotFound {
+			return c.path, true
+		}
+	}
+
+	return "", false
+}
+
+// revalidate fetches lyrics for the cache file again and replaces the cached
+// lyrics only if they changed upstream. The cache is read and fetched without
+// the lock and left alone if another process changes it meanwhile.
+func revalidate(filePath string) error {
+	key := strings.TrimSuffix(filepath.Base(filePath), ".csv")
+	modified := modTime(filePath)
+	touchCache := func() error { return touch(filePath) }
+
+	header, err := readHeader(filePath)
+	if err != nil {
+		return err
+	}
+
+	var rawQuery, lrclibID string
+	var pinned bool
+	for line := range slices.Values(header) {
+		if v, ok := strings.CutPrefix(line, "# "+headerQuery+": "); ok {
+			rawQuery = v
+		}
+		if v, ok := strings.CutPrefix(line, "# "+headerLrclibID+": "); ok {
+			lrclibID = v
+		}
+		if line == headerLine(headerPinned, "true") {
+			pinned = true
+		}
+	}
+
+	if rawQuery == "" {
+		// The query is added when the track plays again
+		slog.Debug("Cache has no lrclib query, skipping revalidation", "file", filePath)
+		return ifUnchanged(key, filePath, modified, touchCache)
+	}
+
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return fmt.Errorf("invalid lrclib query: %w", err)
+	}
+
+	cached, err := LoadCache(filePath)
+	if err != nil && !errors.Is(err, ErrLyricsNotExists) {
+		return err
+	}
+
+	// Pinned lyrics are revalidated by id, others by the original query
+	var res *LrcLibResponse
+	if pinned {
+		var id int
+		id, err = strconv.Atoi(lrclibID)
+		if err != nil {
+			return fmt.Errorf("invalid lrclib id: %w", err)
+		}
+		res, err = FetchID(id)
+	} else {
+		res, err = Fetch(query)
+	}
+	if err == nil && !pinned && IsDenied(key, res.ID) {
+		slog.Debug("Lrclib match is flagged as wrong, keeping cache", "file", filePath)
+		return ifUnchanged(key, filePath, modified, touchCache)
+	}
+
+	var lyrics shared.Lyrics
+	if err == nil {
+		lyrics, err = res.Lyrics()
+	}
+	if errors.Is(err, ErrLyricsNotFound) || errors.Is(err, ErrLyricsNotSynced) {
+		slog.Debug("Lyrics are unavailable upstream, keeping cache", "file", filePath)
+		return ifUnchanged(key, filePath, modified, touchCache)
+	}
+	if err != nil {
+		return err
+	}
+
+	if slices.Equal(cached, lyrics) {
+		slog.Debug("Lyrics are unchanged upstream", "file", filePath)
+		return ifUnchanged(key, filePath, modified, touchCache)
+	}
+
+	newHeader := slices.DeleteFunc(header, func(line string) bool {
+		return strings.HasPrefix(line, "# "+headerLrclibID+": ") ||
+			strings.HasPrefix(line, "# "+headerStatus+": ")
+	})
+	newHeader = append(newHeader, headerLine(headerLrclibID, strconv.Itoa(res.ID)))
+
+	return ifUnchanged(key, filePath, modified, func() error {
+		if err := writeCache(filePath, newHeader, lyrics); err != nil {
+			return err
+		}
+		Store.Delete(key)
+
+		changed, retimed := diffLyrics(cached, lyrics)
+		slog.Info("Replaced cached lyrics with upstream changes",
+			"title", query.Get("track_name"),
+			"artist", query.Get("artist_name"),
+			"lines-before", len(cached),
+			"lines-after", len(lyrics),
+			"changed", changed,
+			"retimed", retimed,
+		)
+		return nil
+	})
+}
+
+// ifUnchanged calls fn with the lock of the cache key held, unless the cache
+// file was modified since modified
+func ifUnchanged(key, filePath string, modified time.Time, fn func() error) error {
+	unlock := Lock(key)
+	defer unlock()
+
+	if !modTime(filePath).Equal(modified) {
+		slog.Debug("Cache changed during revalidation, skipping", "file", filePath)
+		return nil
+	}
+	return fn()
+}
+
+// addQuery adds lrclib query of the track to the cache header if it's missing,
+// e.g. caches written by older versions, so the cache can be revalidated. The
+// modification time is kept, so the cache doesn't look fresh.
+func addQuery(info *player.Info, key string) error {
+	filePath := CachePath(key)
+
+	header, err := ReadHeader(filePath)
+	if err != nil {
+		return err
+	}
+	if _, ok := header[headerQuery]; ok {
+		return nil
+	}
+
+	unlock := Lock(key)
+	defer unlock()
+
+	stat, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	lines, err := readHeader(filePath)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(lines, func(line string) bool {
+		return strings.HasPrefix(line, "# "+headerQuery+": ")
+	}) {
+		return nil // Added by another process
+	}
+
+	lyrics, err := LoadCache(filePath)
+	if err != nil && !errors.Is(err, ErrLyricsNotExists) {
+		return err
+	}
+
+	lines = append(lines, headerLine(headerQuery, Query(info).Encode()))
+	if err := writeCache(filePath, lines, lyrics); err != nil {
+		return err
+	}
+	slog.Debug("Added lrclib query to cache", "file", filePath)
+
+	return os.Chtimes(filePath, stat.ModTime(), stat.ModTime())
+}
+
+// diffLyrics compares lyrics line by line and returns the number of lines
+// with different text and the number of lines only with different timing
+func diffLyrics(a, b shared.Lyrics) (changed, retimed int) {
+	for i := range max(len(a), len(b)) {
+		if i >= len(a) || i >= len(b) || a[i].Text != b[i].Text {
+			changed++
+			continue
+		}
+		if a[i].Timestamp != b[i].Timestamp {
+			retimed++
+		}
+	}
+	return changed, retimed
+}
+
+// touch marks the cache file as fresh
+func touch(filePath string) error {
+	now := time.Now()
+	return os.Chtimes(filePath, now, now)
+}
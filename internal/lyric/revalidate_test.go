@@ -0,0 +1,78 @@
+package lyric
+
+import (
+	"net/url"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+func TestDiffLyrics(t *testing.T) {
+	old := shared.Lyrics{
+		{Timestamp: 0},
+		{Timestamp: time.Second, Text: "First"},
+		{Timestamp: 2 * time.Second, Text: "Second"},
+		{Timestamp: 3 * time.Second, Text: "Thrid"},
+	}
+	updated := shared.Lyrics{
+		{Timestamp: 0},
+		{Timestamp: time.Second, Text: "First"},
+		{Timestamp: 2500 * time.Millisecond, Text: "Second"},
+		{Timestamp: 3 * time.Second, Text: "Third"},
+		{Timestamp: 4 * time.Second, Text: "Fourth"},
+	}
+
+	changed, retimed := diffLyrics(old, updated)
+	if changed != 2 || retimed != 1 {
+		t.Errorf("diffLyrics() = %d, %d; want 2, 1", changed, retimed)
+	}
+
+	changed, retimed = diffLyrics(nil, updated)
+	if changed != len(updated) || retimed != 0 {
+		t.Errorf("diffLyrics() from missing = %d, %d; want %d, 0", changed, retimed, len(updated))
+	}
+}
+
+func TestAddQuery(t *testing.T) {
+	CacheDir = t.TempDir()
+	info := &player.Info{
+		Player: "org.mpris.MediaPlayer2.test",
+		ID:     "test-id",
+		Title:  "Song",
+		Artist: "Artist",
+		Length: 200 * time.Second,
+	}
+	key := CacheKey(info)
+	lyrics := shared.Lyrics{{}, {Timestamp: time.Second, Text: "Hello, world"}}
+
+	if err := SaveCache(info, lyrics, CachePath(key)); err != nil {
+		t.Fatalf("SaveCache() failed: %v", err)
+	}
+	old := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	os.Chtimes(CachePath(key), old, old)
+
+	if err := addQuery(info, key); err != nil {
+		t.Fatalf("addQuery() failed: %v", err)
+	}
+
+	header, err := ReadHeader(CachePath(key))
+	if err != nil {
+		t.Fatalf("ReadHeader() failed: %v", err)
+	}
+	query, err := url.ParseQuery(header[headerQuery])
+	if err != nil || query.Get("track_name") != "Song" || query.Get("duration") != "200.00" {
+		t.Errorf("addQuery() wrote query %q, want query of the track", header[headerQuery])
+	}
+
+	loaded, err := LoadCache(CachePath(key))
+	if err != nil || !slices.Equal(loaded, lyrics) {
+		t.Errorf("LoadCache() = %v, %v, want %v", loaded, err, lyrics)
+	}
+	if !modTime(CachePath(key)).Equal(old) {
+		t.Errorf("addQuery() changed modification time to %v, want %v", modTime(CachePath(key)), old)
+	}
+}
@@ -0,0 +1,372 @@
+package player
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/config"
+	"github.com/Nadim147c/waybar-lyric/internal/state"
+	"github.com/godbus/dbus/v5"
+	"github.com/spf13/cast"
+)
+
+const (
+	// mprisPath is the object path of mpris players
+	mprisPath = "/org/mpris/MediaPlayer2"
+	// propertiesChanged is the signal sent when player properties change
+	propertiesChanged = "org.freedesktop.DBus.Properties.PropertiesChanged"
+	// seeked is the signal sent when player position changes unexpectedly
+	seeked = mpris.PlayerInterface + ".Seeked"
+	// nameOwnerChanged is the signal sent when bus names appear or disappear
+	nameOwnerChanged = "org.freedesktop.DBus.NameOwnerChanged"
+	// followedState is the state file with the player followed by the main loop
+	followedState = "player"
+)
+
+// followed is the state of the player followed by the main loop
+type followed struct {
+	Name string `json:"name"`
+}
+
+// activity tracks playback status changes of all players, the same way as
+// playerctld, to follow the player which started playing most recently
+type activity struct {
+	mu       sync.Mutex
+	watching bool
+	// names maps bus names of live players to unique connection names
+	names map[string]string
+	// owners maps unique connection names to player bus names
+	owners map[string]string
+	status map[string]mpris.PlaybackStatus
+	// started is when the player last started playing
+	started map[string]time.Time
+	// active is when the playback status of the player last changed
+	active   map[string]time.Time
+	followed string
+}
+
+func newActivity() *activity {
+	return &activity{
+		names:   map[string]string{},
+		owners:  map[string]string{},
+		status:  map[string]mpris.PlaybackStatus{},
+		started: map[string]time.Time{},
+		active:  map[string]time.Time{},
+	}
+}
+
+// tracker is the activity of players on the session bus
+var tracker = newActivity()
+
+// Watch tracks live players and their playback status until ctx is done. The
+// returned channel receives signals sent by any player and signals of players
+// appearing or disappearing.
+func Watch(ctx context.Context, conn *dbus.Conn) (<-chan *dbus.Signal, error) {
+	// Subscribe before listing players to not miss any of them
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+
+	rules := [][]dbus.MatchOption{
+		{dbus.WithMatchObjectPath(mprisPath)},
+		{
+			dbus.WithMatchInterface("org.freedesktop.DBus"),
+			dbus.WithMatchMember("NameOwnerChanged"),
+			dbus.WithMatchArg0Namespace(mpris.BaseInterface),
+		},
+	}
+	for rule := range slices.Values(rules) {
+		if err := conn.AddMatchSignal(rule...); err != nil {
+			conn.RemoveSignal(signals)
+			return nil, err
+		}
+	}
+
+	players, err := mpris.List(conn)
+	if err != nil {
+		conn.RemoveSignal(signals)
+		return nil, err
+	}
+
+	tracker.mu.Lock()
+	// Unique names and status are outdated after reconnecting
+	clear(tracker.names)
+	clear(tracker.owners)
+	clear(tracker.status)
+	tracker.mu.Unlock()
+
+	for name := range slices.Values(players) {
+		owner, err := ownerOf(conn, name)
+		if err != nil {
+			slog.Debug("Failed to get player name owner", "player", name, "error", err)
+			continue
+		}
+		// Players existing on startup have no known activity
+		tracker.add(conn, name, owner, time.Time{})
+	}
+
+	tracker.mu.Lock()
+	tracker.watching = true
+	tracker.mu.Unlock()
+
+	out := make(chan *dbus.Signal, 16)
+	go func() {
+		defer conn.RemoveSignal(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig, ok := <-signals:
+				if !ok {
+					return // Connection is closed
+				}
+				if sig.Path != mprisPath && !tracker.handleOwner(conn, sig) {
+					continue
+				}
+				tracker.handle(sig)
+				select {
+				case out <- sig:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+// Owner returns the unique connection name of the player. Signals sent by the
+// player have it as sender.
+func Owner(conn *dbus.Conn, name string) (string, error) {
+	tracker.mu.Lock()
+	owner, ok := tracker.names[name]
+	tracker.mu.Unlock()
+	if ok {
+		return owner, nil
+	}
+	return ownerOf(conn, name)
+}
+
+// ownerOf asks the bus for the unique connection name of the player
+func ownerOf(conn *dbus.Conn, name string) (string, error) {
+	var owner string
+	err := conn.BusObject().Call("org.freedesktop.DBus.GetNameOwner", 0, name).Store(&owner)
+	return owner, err
+}
+
+// OwnerChanged reports whether the signal is sent for a player appearing or
+// disappearing
+func OwnerChanged(sig *dbus.Signal) bool {
+	if sig.Name != nameOwnerChanged || len(sig.Body) < 3 {
+		return false
+	}
+	name, _ := sig.Body[0].(string)
+	return strings.HasPrefix(name, mpris.BaseInterface+".")
+}
+
+// names returns bus names of live players
+func names(conn *dbus.Conn) ([]string, error) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if !tracker.watching {
+		return mpris.List(conn)
+	}
+	return slices.Sorted(maps.Keys(tracker.names)), nil
+}
+
+// Changed returns player properties changed by a PropertiesChanged signal
+func Changed(sig *dbus.Signal) (map[string]dbus.Variant, bool) {
+	if sig.Name != propertiesChanged || len(sig.Body) < 2 {
+		return nil, false
+	}
+	if iface, _ := sig.Body[0].(string); iface != mpris.PlayerInterface {
+		return nil, false
+	}
+	props, ok := sig.Body[1].(map[string]dbus.Variant)
+	return props, ok
+}
+
+// Seeked returns the new position from a Seeked signal
+func Seeked(sig *dbus.Signal) (time.Duration, bool) {
+	if sig.Name != seeked || len(sig.Body) < 1 {
+		return 0, false
+	}
+	us, ok := sig.Body[0].(int64)
+	return time.Duration(us) * time.Microsecond, ok
+}
+
+// add records a live player and its playback status at given time
+func (a *activity) add(conn *dbus.Conn, name, owner string, at time.Time) {
+	status, err := mpris.New(conn, name).GetPlaybackStatus()
+	if err != nil {
+		slog.Debug("Failed to get playback status", "player", name, "error", err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.names[name] = owner
+	a.owners[owner] = name
+	if status != "" {
+		a.update(name, status, at)
+	}
+}
+
+// remove forgets a player which left the bus
+func (a *activity) remove(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.owners, a.names[name])
+	delete(a.names, name)
+	delete(a.status, name)
+}
+
+// handleOwner updates live players from a NameOwnerChanged signal. It reports
+// whether the signal is for a player.
+func (a *activity) handleOwner(conn *dbus.Conn, sig *dbus.Signal) bool {
+	if !OwnerChanged(sig) {
+		return false
+	}
+	name, _ := sig.Body[0].(string)
+	owner, _ := sig.Body[2].(string)
+
+	a.remove(name)
+	if owner == "" {
+		slog.Info("Player disappeared", "name", name)
+		return true
+	}
+
+	slog.Info("Player appeared", "name", name)
+	a.add(conn, name, owner, time.Now())
+	return true
+}
+
+// handle records playback status changes from the signal
+func (a *activity) handle(sig *dbus.Signal) {
+	props, _ := Changed(sig)
+	value, ok := props["PlaybackStatus"]
+	if !ok {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	name, ok := a.owners[sig.Sender]
+	if !ok {
+		slog.Debug("Unknown player sent signal", "sender", sig.Sender)
+		return
+	}
+
+	status := mpris.PlaybackStatus(cast.ToString(value.Value()))
+	slog.Debug("Playback status changed", "player", name, "status", status)
+	a.update(name, status, time.Now())
+}
+
+// update records playback status of the player at given time
+func (a *activity) update(name string, status mpris.PlaybackStatus, now time.Time) {
+	if a.status[name] == status {
+		return
+	}
+	if status == mpris.PlaybackPlaying {
+		a.started[name] = now
+	}
+	a.status[name] = status
+	a.active[name] = now
+}
+
+// compare orders playing players by when they started playing and the others
+// by when they were last active, most recent first
+func (a *activity) compare(x, y string) int {
+	xPlaying := a.status[x] == mpris.PlaybackPlaying
+	yPlaying := a.status[y] == mpris.PlaybackPlaying
+	if xPlaying != yPlaying {
+		if xPlaying {
+			return -1
+		}
+		return 1
+	}
+	if xPlaying {
+		return a.started[y].Compare(a.started[x])
+	}
+	return a.active[y].Compare(a.active[x])
+}
+
+// snapshot returns activity of the players for processes which don't watch
+// the bus. Current playback status is read from the players and the player
+// followed by the main loop is the most recently active one.
+func snapshot(conn *dbus.Conn, found []candidate) *activity {
+	a := newActivity()
+	for c := range slices.Values(found) {
+		status, err := mpris.New(conn, c.name).GetPlaybackStatus()
+		if err != nil {
+			continue
+		}
+		a.status[c.name] = status
+	}
+
+	if name := followedPlayer(); name != "" {
+		now := time.Now()
+		a.started[name] = now
+		a.active[name] = now
+	}
+
+	return a
+}
+
+// followedPlayer returns the player followed by the main loop from the state
+// file, or an empty string if it's unknown
+func followedPlayer() string {
+	var f followed
+	err := state.Load(followedState, &f)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Failed to load followed player", "error", err)
+	}
+	return f.Name
+}
+
+// order sorts the players by --player pattern priority and then by activity
+func order(conn *dbus.Conn, found []candidate) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	a := tracker
+	if !tracker.watching {
+		a = snapshot(conn, found)
+	}
+
+	slices.SortStableFunc(found, func(x, y candidate) int {
+		return cmp.Or(
+			matchIndex(config.Players, x.name)-matchIndex(config.Players, y.name),
+			a.compare(x.name, y.name),
+		)
+	})
+}
+
+// follow records the player selected by the main loop, so subcommands can
+// control the same player
+func follow(name string) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	if !tracker.watching || tracker.followed == name {
+		return
+	}
+	tracker.followed = name
+
+	slog.Info("Following player", "name", name)
+	if err := state.Save(followedState, followed{Name: name}); err != nil {
+		slog.Warn("Failed to save followed player", "error", err)
+	}
+}
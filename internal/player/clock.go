@@ -0,0 +1,140 @@
+package player
+
+import (
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+)
+
+// CoarseInterval is the time between position queries of players with coarse
+// position until a step of the reported position is observed
+const CoarseInterval = 200 * time.Millisecond
+
+// coarseStep is the resolution of coarse position reports
+const coarseStep = time.Second
+
+// CoarseCorrection is added to positions reported by players with coarse
+// position. Reports are rounded down, so the middle of the step is expected.
+const CoarseCorrection = coarseStep / 2
+
+// Clock extrapolates player position between D-Bus queries from the
+// monotonic clock, scaled by playback rate
+type Clock struct {
+	position time.Duration
+	length   time.Duration
+	at       time.Time
+	rate     float64
+	running  bool
+
+	// coarse is set for players which report position rounded to seconds
+	coarse bool
+	// anchored is set when a step of coarse position reports was observed
+	anchored bool
+	report   time.Duration
+	reportAt time.Time
+}
+
+// Sync sets the clock to the position of the player info observed at given
+// time
+func (c *Clock) Sync(info *Info, at time.Time) {
+	expected := c.Position(at)
+	if info.Latency.Coarse != c.coarse {
+		c.anchored = false
+	}
+
+	c.length = info.Length
+	c.rate = info.Rate
+	c.running = info.Status == mpris.PlaybackPlaying
+	c.coarse = info.Latency.Coarse
+
+	c.observe(info.Position, expected, at)
+}
+
+// Seek sets the position observed at given time
+func (c *Clock) Seek(position time.Duration, at time.Time) {
+	c.anchored = false
+	c.reportAt = time.Time{}
+	c.observe(position, 0, at)
+}
+
+// Observe updates the clock with position reported by the player at given
+// time
+func (c *Clock) Observe(reported time.Duration, at time.Time) {
+	c.observe(reported, c.Position(at), at)
+}
+
+// observe updates the clock with the reported position. Coarse reports are
+// corrected to the middle of the step by Info.SetPosition. They're only
+// trusted at observed steps, between them the extrapolated position is kept as
+// long as it's within the step.
+func (c *Clock) observe(reported, expected time.Duration, at time.Time) {
+	prev, prevAt := c.report, c.reportAt
+	c.report, c.reportAt = reported, at
+	c.at = at
+
+	if !c.coarse {
+		c.position = reported
+		return
+	}
+
+	elapsed := at.Sub(prevAt)
+	switch {
+	case c.running && !prevAt.IsZero() && elapsed <= 2*CoarseInterval &&
+		reported > prev && reported-prev <= coarseStep+c.scale(elapsed):
+		// The step happened between the reports
+		c.position = reported - CoarseCorrection + c.scale(elapsed/2)
+		c.anchored = true
+	case c.anchored && expected >= reported-CoarseCorrection && expected < reported+CoarseCorrection:
+		c.position = expected
+	default:
+		c.position = reported
+		c.anchored = false
+	}
+}
+
+// scale converts real time to duration of the track at current rate
+func (c *Clock) scale(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * c.rate)
+}
+
+// Settled reports whether the position is known precisely. Coarse clocks
+// settle after a step of the reported position is observed.
+func (c *Clock) Settled() bool {
+	return !c.coarse || c.anchored || !c.running
+}
+
+// SetRate changes playback rate from given time
+func (c *Clock) SetRate(rate float64, at time.Time) {
+	if rate <= 0 {
+		return
+	}
+	c.position = c.Position(at)
+	c.at = at
+	c.rate = rate
+}
+
+// RealTime converts duration of the track to real time at current rate
+func (c *Clock) RealTime(d time.Duration) time.Duration {
+	if c.rate <= 0 {
+		return d
+	}
+	return time.Duration(float64(d) / c.rate)
+}
+
+// Position returns extrapolated position at given time. The position doesn't
+// exceed the track length.
+func (c *Clock) Position(at time.Time) time.Duration {
+	pos := c.position
+	if c.running {
+		pos += c.scale(at.Sub(c.at))
+	}
+	if c.length > 0 {
+		pos = min(pos, c.length)
+	}
+	return max(pos, 0)
+}
+
+// Ended reports whether extrapolated position reached the end of the track
+func (c *Clock) Ended(at time.Time) bool {
+	return c.running && c.length > 0 && c.Position(at) >= c.length
+}
@@ -0,0 +1,104 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Now()
+	info := &Info{
+		Position: 10 * time.Second,
+		Length:   time.Minute,
+		Rate:     1.5,
+		Status:   mpris.PlaybackPlaying,
+	}
+
+	var c Clock
+	c.Sync(info, start)
+
+	if got, want := c.Position(start.Add(2*time.Second)), 13*time.Second; got != want {
+		t.Errorf("Position() = %v, want %v", got, want)
+	}
+
+	c.Seek(30*time.Second, start.Add(2*time.Second))
+	if got, want := c.Position(start.Add(4*time.Second)), 33*time.Second; got != want {
+		t.Errorf("Position() after seek = %v, want %v", got, want)
+	}
+
+	if got := c.Position(start.Add(time.Hour)); got != time.Minute {
+		t.Errorf("Position() past the end = %v, want track length", got)
+	}
+	if !c.Ended(start.Add(time.Hour)) {
+		t.Error("Ended() = false past the end")
+	}
+
+	info.Status = mpris.PlaybackPaused
+	c.Sync(info, start)
+	if got := c.Position(start.Add(time.Minute)); got != info.Position {
+		t.Errorf("Position() while paused = %v, want %v", got, info.Position)
+	}
+}
+
+func TestClockRate(t *testing.T) {
+	start := time.Now()
+	info := &Info{
+		Position: 10 * time.Second,
+		Length:   time.Minute,
+		Rate:     1,
+		Status:   mpris.PlaybackPlaying,
+	}
+
+	var c Clock
+	c.Sync(info, start)
+	c.SetRate(2, start.Add(time.Second))
+
+	if got, want := c.Position(start.Add(3*time.Second)), 15*time.Second; got != want {
+		t.Errorf("Position() after rate change = %v, want %v", got, want)
+	}
+	if got, want := c.RealTime(4*time.Second), 2*time.Second; got != want {
+		t.Errorf("RealTime() = %v, want %v", got, want)
+	}
+}
+
+func TestClockCoarse(t *testing.T) {
+	start := time.Now()
+	info := &Info{
+		Length:  time.Minute,
+		Rate:    1,
+		Status:  mpris.PlaybackPlaying,
+		Latency: Latency{Coarse: true},
+	}
+	observe := func(c *Clock, reported time.Duration, at time.Time) {
+		info.SetPosition(reported)
+		c.Observe(info.Position, at)
+	}
+
+	info.SetPosition(10 * time.Second)
+	var c Clock
+	c.Sync(info, start)
+	if got, want := c.Position(start), 10500*time.Millisecond; got != want {
+		t.Errorf("Position() before a step = %v, want middle of the second %v", got, want)
+	}
+	if c.Settled() {
+		t.Error("Settled() = true before a step")
+	}
+
+	// Real position is 10.7s at start, so the report steps to 11s at 300ms
+	observe(&c, 10*time.Second, start.Add(200*time.Millisecond))
+	observe(&c, 11*time.Second, start.Add(400*time.Millisecond))
+	if !c.Settled() {
+		t.Fatal("Settled() = false after a step")
+	}
+	if got, want := c.Position(start.Add(400*time.Millisecond)), 11100*time.Millisecond; got != want {
+		t.Errorf("Position() after a step = %v, want %v", got, want)
+	}
+
+	// Reports consistent with the extrapolated position don't change it
+	observe(&c, 13*time.Second, start.Add(3*time.Second))
+	if got, want := c.Position(start.Add(3*time.Second)), 13700*time.Millisecond; got != want {
+		t.Errorf("Position() after consistent report = %v, want %v", got, want)
+	}
+}
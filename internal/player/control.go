@@ -0,0 +1,72 @@
+package player
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/godbus/dbus/v5"
+)
+
+// FadeStep is the time between volume changes while fading
+const FadeStep = 50 * time.Millisecond
+
+// ErrUnsupported is returned when the player doesn't support an action
+var ErrUnsupported = errors.New("action not supported by player")
+
+// IsMissingProperty reports whether err is returned by the player for a
+// property it doesn't implement. Players return UnknownProperty or
+// InvalidArgs for them.
+func IsMissingProperty(err error) bool {
+	var dbusErr dbus.Error
+	if !errors.As(err, &dbusErr) {
+		return false
+	}
+	return dbusErr.Name == "org.freedesktop.DBus.Error.UnknownProperty" ||
+		dbusErr.Name == "org.freedesktop.DBus.Error.InvalidArgs"
+}
+
+// Can returns ErrUnsupported if the player doesn't report the capability,
+// e.g. CanGoNext or CanControl
+func Can(conn *dbus.Conn, mp *mpris.Player, capability string) error {
+	v, err := conn.Object(mp.GetName(), mprisPath).GetProperty(mpris.PlayerInterface + "." + capability)
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", capability, err)
+	}
+	if ok, _ := v.Value().(bool); !ok {
+		return fmt.Errorf("%s doesn't report %s: %w", ShortName(mp.GetName()), capability, ErrUnsupported)
+	}
+	return nil
+}
+
+// Fade changes the player volume to volume in steps over d. It returns
+// ctx.Err() if ctx is done before the volume is reached.
+func Fade(ctx context.Context, mp *mpris.Player, volume float64, d time.Duration) error {
+	if d <= 0 {
+		return mp.SetVolume(volume)
+	}
+
+	from, err := mp.GetVolume()
+	if err != nil {
+		return fmt.Errorf("failed to get current volume: %w", err)
+	}
+
+	steps := max(int(d/FadeStep), 1)
+	ticker := time.NewTicker(d / time.Duration(steps))
+	defer ticker.Stop()
+
+	for i := 1; i <= steps; i++ {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		v := from + (volume-from)*float64(i)/float64(steps)
+		if err := mp.SetVolume(v); err != nil {
+			return fmt.Errorf("failed to set volume: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestIsMissingProperty(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"unknown property", dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownProperty"}, true},
+		{"invalid args", dbus.Error{Name: "org.freedesktop.DBus.Error.InvalidArgs"}, true},
+		{"wrapped", fmt.Errorf("failed: %w", dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownProperty"}), true},
+		{"no reply", dbus.Error{Name: "org.freedesktop.DBus.Error.NoReply"}, false},
+		{"other", errors.New("dbus connection closed"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsMissingProperty(tt.err); got != tt.want {
+				t.Errorf("IsMissingProperty(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
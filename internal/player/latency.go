@@ -0,0 +1,142 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/config"
+	"github.com/Nadim147c/waybar-lyric/internal/sink"
+)
+
+// Latency is the position correction of a player
+type Latency struct {
+	// Offset is added to the position reported by the player. It's real time,
+	// so it's scaled by playback rate.
+	Offset time.Duration
+	// Coarse is set for players which report position rounded down to
+	// seconds. Position is interpolated between the steps of the reports.
+	Coarse bool
+}
+
+// ValidatePlayerOffsets checks if per player position offsets are valid
+func ValidatePlayerOffsets(offsets map[string]string) error {
+	for pattern, offset := range offsets {
+		if _, err := time.ParseDuration(offset); err != nil {
+			return fmt.Errorf("invalid position offset %q for %q: %w", offset, pattern, err)
+		}
+	}
+	return ValidatePatterns(slices.Collect(maps.Keys(offsets)))
+}
+
+// matchPlayer returns index of the first glob pattern matching the player
+// name or the host of the track url, e.g. music.youtube.com in browsers
+func matchPlayer(patterns []string, info *Info) int {
+	if i := matchIndex(patterns, info.Player); i >= 0 {
+		return i
+	}
+	if info.URL == nil || info.URL.Host == "" {
+		return -1
+	}
+	return matchIndex(patterns, strings.ToLower(info.URL.Host))
+}
+
+// LatencyPattern returns the pattern which matches the player of the info in
+// --player-offset and --coarse-position. Browsers are matched by website.
+func LatencyPattern(info *Info) string {
+	if isBrowser(info.Player) && info.URL != nil && info.URL.Host != "" {
+		return strings.ToLower(info.URL.Host)
+	}
+	return ShortName(info.Player)
+}
+
+// LatencyFor returns the position correction for the player of the info from
+// --player-offset and --coarse-position patterns and --sink-offset of the
+// default audio sink
+func LatencyFor(info *Info) Latency {
+	var l Latency
+
+	patterns := slices.Sorted(maps.Keys(config.PlayerOffsets))
+	if i := matchPlayer(patterns, info); i >= 0 {
+		// Offsets are validated on startup
+		l.Offset, _ = time.ParseDuration(config.PlayerOffsets[patterns[i]])
+	}
+
+	l.Coarse = matchPlayer(config.CoarsePositions, info) >= 0
+
+	// Lyrics are heard later through outputs with latency
+	l.Offset -= sink.CurrentDelay()
+
+	return l
+}
+
+// ErrFewSamples is returned when position reports don't change enough to
+// calibrate the player
+var ErrFewSamples = errors.New("reported position didn't change enough, keep the player playing")
+
+// Sample is a position reported by a player at a time
+type Sample struct {
+	At       time.Time
+	Position time.Duration
+}
+
+// Calibration describes how a player reports position
+type Calibration struct {
+	// Interval is the median real time between changes of reported position
+	Interval time.Duration
+	// Step is the median change of reported position
+	Step time.Duration
+	// Latency is the suggested position correction
+	Latency Latency
+}
+
+// median returns median of the durations
+func median(d []time.Duration) time.Duration {
+	slices.Sort(d)
+	return d[len(d)/2]
+}
+
+// Calibrate measures how position reports of a player step. Players which
+// report whole seconds are coarse. Players which update position periodically
+// report it half of the interval late on average.
+func Calibrate(samples []Sample) (Calibration, error) {
+	var intervals, steps []time.Duration
+	var changedAt time.Time
+
+	for i := 1; i < len(samples); i++ {
+		prev, s := samples[i-1], samples[i]
+		if s.Position < prev.Position {
+			return Calibration{}, errors.New("reported position jumped backward, don't seek while calibrating")
+		}
+		if s.Position == prev.Position {
+			continue
+		}
+
+		// Time before the first change is a partial interval
+		if !changedAt.IsZero() {
+			intervals = append(intervals, s.At.Sub(changedAt))
+			steps = append(steps, s.Position-prev.Position)
+		}
+		changedAt = s.At
+	}
+
+	if len(intervals) < 3 {
+		return Calibration{}, ErrFewSamples
+	}
+
+	c := Calibration{
+		Interval: median(intervals),
+		Step:     median(steps),
+	}
+	c.Latency.Coarse = c.Step >= coarseStep && !slices.ContainsFunc(samples, func(s Sample) bool {
+		return s.Position%time.Second != 0
+	})
+	if !c.Latency.Coarse && c.Interval > 100*time.Millisecond {
+		c.Latency.Offset = (c.Interval / 2).Round(10 * time.Millisecond)
+	}
+
+	return c, nil
+}
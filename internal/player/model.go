@@ -2,9 +2,7 @@ package player
 
 import (
 	"encoding/json"
-	"log/slog"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/Nadim147c/go-mpris"
@@ -27,8 +25,11 @@ type Info struct {
 	Position time.Duration `json:"position"`
 	Length   time.Duration `json:"length"`
 	Shuffle  bool          `json:"shuffle"`
+	Rate     float64       `json:"rate"`
 
 	Status mpris.PlaybackStatus `json:"status"`
+
+	Latency Latency `json:"-"`
 }
 
 // MarshalJSON encodes PlayerInfo with durations in seconds (float)
@@ -59,15 +60,35 @@ func (p *Info) UpdatePosition(player *mpris.Player) error {
 	if err != nil {
 		return err
 	}
-	p.Position = pos
+	p.SetPosition(pos)
+	return nil
+}
 
-	// HACK: YoutubeMusic dbus position is rounded to seconds which isn't ideal for realtime lyrics.
-	// Add 1.1sec delay make lyrics always appear before the song.
-	if player.GetName() == mpris.BaseInterface+".YoutubeMusic" ||
-		(p.URL != nil && strings.Contains(p.URL.Host, "music.youtube.com")) {
-		slog.Debug("Adding 1.1 second to adjust mpris delay")
-		p.Position += 1100 * time.Millisecond
+// SetPosition sets the position reported by the player, corrected by the
+// latency of the player. Coarse positions are moved to the middle of the step.
+func (p *Info) SetPosition(pos time.Duration) {
+	if p.Latency.Coarse {
+		pos += CoarseCorrection
 	}
+	p.Position = pos + p.latencyOffset()
+}
 
-	return nil
+// PlayerPosition converts a position corrected by the latency back to the
+// position of the player, e.g. to seek the player
+func (p *Info) PlayerPosition(pos time.Duration) time.Duration {
+	return max(pos-p.latencyOffset(), 0)
+}
+
+// LyricPosition converts a position of the player to the position corrected
+// by the latency, which lyrics are timed against
+func (p *Info) LyricPosition(pos time.Duration) time.Duration {
+	return pos + p.latencyOffset()
+}
+
+// latencyOffset returns the latency offset scaled by playback rate
+func (p *Info) latencyOffset() time.Duration {
+	if p.Rate > 0 {
+		return time.Duration(float64(p.Latency.Offset) * p.Rate)
+	}
+	return p.Latency.Offset
 }
@@ -0,0 +1,29 @@
+package player
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInfo_PlayerPosition(t *testing.T) {
+	info := &Info{
+		Rate:    2,
+		Latency: Latency{Offset: -150 * time.Millisecond},
+	}
+
+	info.SetPosition(10 * time.Second)
+	if got, want := info.Position, 9700*time.Millisecond; got != want {
+		t.Errorf("SetPosition() = %v, want %v", got, want)
+	}
+	if got, want := info.PlayerPosition(info.Position), 10*time.Second; got != want {
+		t.Errorf("PlayerPosition() = %v, want %v", got, want)
+	}
+	if got := info.PlayerPosition(0); got != 300*time.Millisecond {
+		t.Errorf("PlayerPosition(0) = %v, want 300ms", got)
+	}
+
+	info.Latency.Offset = time.Second
+	if got := info.PlayerPosition(time.Second); got != 0 {
+		t.Errorf("PlayerPosition() before the start = %v, want 0", got)
+	}
+}
@@ -6,12 +6,16 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/url"
 	"path"
+	"regexp"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/config"
 	"github.com/godbus/dbus/v5"
 	"github.com/spf13/cast"
 )
@@ -71,7 +75,66 @@ func artistTitleFunc(p *mpris.Player) (string, error) {
 	return Hash(artist, ":", title), nil
 }
 
-// urlIDFunc: derive ID from URL for fallback players like Firefox
+// musicSite is a music website which can be followed in web browsers
+type musicSite struct {
+	host string
+	// id extracts track id from the url of a track page
+	id func(u *url.URL) string
+}
+
+// pathAfter returns path segment after the given segment
+func pathAfter(u *url.URL, segment string) string {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	i := slices.Index(parts, segment)
+	if i < 0 || i+1 >= len(parts) {
+		return ""
+	}
+	return parts[i+1]
+}
+
+var musicSites = []musicSite{
+	// music.youtube.com/watch?v=xxx
+	{"music.youtube.com", func(u *url.URL) string { return u.Query().Get("v") }},
+	// open.spotify.com/track/xxx
+	{"open.spotify.com", func(u *url.URL) string { return path.Base(u.Path) }},
+	// soundcloud.com/artist/track
+	{"soundcloud.com", func(u *url.URL) string {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) != 2 || parts[1] == "sets" {
+			return ""
+		}
+		return parts[0] + "/" + parts[1]
+	}},
+	// www.deezer.com/en/track/123
+	{"deezer.com", func(u *url.URL) string { return pathAfter(u, "track") }},
+	// listen.tidal.com/track/123 or tidal.com/browse/track/123
+	{"tidal.com", func(u *url.URL) string { return pathAfter(u, "track") }},
+	// artist.bandcamp.com/track/name
+	{"bandcamp.com", func(u *url.URL) string { return pathAfter(u, "track") }},
+	// music.apple.com/us/album/name/123?i=456 or music.apple.com/us/song/name/456
+	{"music.apple.com", func(u *url.URL) string {
+		if id := u.Query().Get("i"); id != "" {
+			return id
+		}
+		if pathAfter(u, "song") != "" {
+			return path.Base(u.Path)
+		}
+		return ""
+	}},
+}
+
+// findMusicSite returns the music site for the host
+func findMusicSite(host string) (musicSite, bool) {
+	host = strings.ToLower(host)
+	for site := range slices.Values(musicSites) {
+		if host == site.host || strings.HasSuffix(host, "."+site.host) {
+			return site, true
+		}
+	}
+	return musicSite{}, false
+}
+
+// urlIDFunc: derive ID from URL for browsers and web based players
 func urlIDFunc(p *mpris.Player) (string, error) {
 	u, err := p.GetURL()
 	if err != nil || u == "" {
@@ -83,84 +146,279 @@ func urlIDFunc(p *mpris.Player) (string, error) {
 		return "", err
 	}
 
-	host := strings.ToLower(parsed.Host)
+	// Only allow known music sites
+	site, ok := findMusicSite(parsed.Host)
+	if !ok {
+		return "", ErrNoID
+	}
 
-	// Only allow music.youtube.com and open.spotify.com
-	if !(strings.Contains(host, "music.youtube.com") || strings.Contains(host, "open.spotify.com")) {
+	id := site.id(parsed)
+	if id == "" {
 		return "", ErrNoID
 	}
 
-	id := ""
-	if strings.Contains(host, "music.youtube.com") {
-		id = parsed.Query().Get("v") // ?v=xxx
-	} else if strings.Contains(host, "open.spotify.com") {
-		id = path.Base(parsed.Path) // /track/xxx
+	return Hash(strings.ToLower(parsed.Host), ":", id), nil
+}
+
+// stableTrackID reports whether mpris:trackid identifies the track itself.
+// Many players use playlist positions or counters as track id, which point to
+// different tracks across sessions, e.g. /org/videolan/vlc/playlist/5.
+func stableTrackID(trackid string) bool {
+	if trackid == "" || strings.HasSuffix(trackid, "/NoTrack") {
+		return false
 	}
+	_, err := strconv.Atoi(path.Base(trackid))
+	return err != nil
+}
 
-	if id == "" {
+// mediaURLIDFunc: uses xesam:url as ID source, the file path for local files
+func mediaURLIDFunc(p *mpris.Player) (string, error) {
+	u, err := p.GetURL()
+	if err != nil || u == "" {
 		return "", ErrNoID
 	}
 
-	return Hash(host, ":", id), nil
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", err
+	}
+
+	if parsed.Scheme == "file" {
+		return Hash(parsed.Path), nil
+	}
+
+	parsed.Fragment = ""
+	return Hash(parsed.String()), nil
+}
+
+// autoIDFunc: uses mpris:trackid when stable, else xesam:url, else
+// artist+title combo as ID source
+func autoIDFunc(p *mpris.Player) (string, error) {
+	meta, err := p.GetMetadata()
+	if err != nil {
+		return "", err
+	}
+
+	if val, ok := meta["mpris:trackid"]; ok && stableTrackID(fmt.Sprint(val.Value())) {
+		return Hash(val), nil
+	}
+
+	if id, err := mediaURLIDFunc(p); err == nil {
+		return id, nil
+	}
+
+	return artistTitleFunc(p)
+}
+
+// IDStrategies are the ID functions which can be chosen per player
+var IDStrategies = map[string]IDFunc{
+	"auto":         autoIDFunc,
+	"trackid":      trackIDFunc,
+	"url":          mediaURLIDFunc,
+	"web":          urlIDFunc,
+	"artist-title": artistTitleFunc,
+}
+
+// ValidateIDStrategies checks if per player ID strategy overrides are valid
+func ValidateIDStrategies(strategies map[string]string) error {
+	for pattern, strategy := range strategies {
+		if _, ok := IDStrategies[strategy]; !ok {
+			return fmt.Errorf("unknown id strategy %q for %q", strategy, pattern)
+		}
+	}
+	return ValidatePatterns(slices.Collect(maps.Keys(strategies)))
+}
+
+// strategyFor returns the ID strategy for the player. Supported players have
+// known strategies, browsers use web and others auto. It's overridden by the
+// first matching --id-strategy pattern in sorted order.
+func strategyFor(busName string) string {
+	patterns := slices.Sorted(maps.Keys(config.IDStrategies))
+	if i := matchIndex(patterns, busName); i >= 0 {
+		return config.IDStrategies[patterns[i]]
+	}
+
+	for p := range slices.Values(supportedPlayers) {
+		if busName == mpris.BaseInterface+"."+p.name {
+			return p.strategy
+		}
+	}
+	if isBrowser(busName) {
+		return "web"
+	}
+	return "auto"
 }
 
 type players struct {
-	name   string
-	idFunc IDFunc
+	name     string
+	strategy string
 }
 
+// supportedPlayers are players with known ID strategy. They're preferred over
+// other players.
 var supportedPlayers = []players{
-	{"spotify", urlIDFunc},
-	{"YoutubeMusic", urlIDFunc},
-	{"amarok", artistTitleFunc},
-	{"io.bassi.Amberol", artistTitleFunc},
+	{"spotify", "web"},
+	{"YoutubeMusic", "web"},
+	{"amarok", "artist-title"},
+	{"io.bassi.Amberol", "artist-title"},
 }
 
-// Select selects correct parses for player
-func Select(conn *dbus.Conn) (*mpris.Player, Parser, error) {
-	players, err := mpris.List(conn)
-	if err != nil {
-		return nil, nil, err
+// browsers are player names of web browsers. Browsers append an instance
+// suffix to the name, e.g. firefox.instance_1_84 or chromium.instance2741.
+var browsers = []string{"firefox", "chromium", "chrome", "brave", "vivaldi", "msedge", "edge"}
+
+// instanceSuffix matches the instance suffix browsers append to the name
+var instanceSuffix = regexp.MustCompile(`\.instance(\d+|_\d+_\d+)$`)
+
+// isBrowser reports whether the player is a web browser. The name without
+// instance suffix must be a browser name, so e.g. chromecast isn't a browser.
+func isBrowser(busName string) bool {
+	name := instanceSuffix.ReplaceAllString(strings.ToLower(ShortName(busName)), "")
+	return slices.Contains(browsers, name)
+}
+
+// proxies are player names of mpris proxies which mirror another player, e.g.
+// playerctld. Following them shows the same track twice or the wrong player.
+var proxies = []string{"playerctld"}
+
+// isProxy reports whether the player is a mpris proxy
+func isProxy(busName string) bool {
+	return slices.Contains(proxies, strings.ToLower(ShortName(busName)))
+}
+
+// ShortName returns player name without the mpris bus name prefix
+func ShortName(busName string) string {
+	return strings.TrimPrefix(busName, mpris.BaseInterface+".")
+}
+
+// matchIndex returns index of the first glob pattern matching the player name
+// or -1 if none matches. Matching is case insensitive.
+func matchIndex(patterns []string, busName string) int {
+	name := strings.ToLower(ShortName(busName))
+	for i, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return i
+		}
 	}
-	slog.Debug("Player names", "players", players)
+	return -1
+}
 
-	if len(players) == 0 {
-		return nil, nil, errors.New("No player exists")
+// ValidatePatterns checks if the player glob patterns are valid
+func ValidatePatterns(patterns []string) error {
+	for pattern := range slices.Values(patterns) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid player pattern %q: %w", pattern, err)
+		}
 	}
+	return nil
+}
+
+// candidate is a player which can be selected
+type candidate struct {
+	name string
+}
+
+// candidates returns players on the bus which waybar-lyric can follow, in
+// default priority order
+func candidates(conn *dbus.Conn, players []string) []candidate {
+	var found []candidate
 
 	// First: explicitly supported players
 	for p := range slices.Values(supportedPlayers) {
 		playerName := mpris.BaseInterface + "." + p.name
 		if slices.Contains(players, playerName) {
-			slog.Debug("Player selected", "name", playerName)
-			return mpris.New(conn, playerName), parserWithIDFunc(DefaultParser, p.idFunc), nil
+			found = append(found, candidate{playerName})
 		}
 	}
 
-	// Fallback: Firefox only if URL is on music.youtube.com or open.spotify.com
+	// Then: browsers only if URL is on a known music site
 	for _, playerName := range players {
-		if !strings.Contains(strings.ToLower(playerName), "firefox") {
+		if !isBrowser(playerName) {
 			continue
 		}
-		slog.Debug("Checking player url", "for", "firefox")
+		if matchIndex(config.IgnorePlayers, playerName) >= 0 {
+			continue // Avoid dbus calls for ignored browsers
+		}
+		slog.Debug("Checking player url", "for", playerName)
 		fp := mpris.New(conn, playerName)
 		u, err := fp.GetURL()
 		if err != nil || u == "" {
-			slog.Debug("Checking player url", "for", "firefox")
+			slog.Debug("Player has no url", "for", playerName)
 			continue
 		}
 		pu, err := url.Parse(u)
 		if err != nil {
 			continue
 		}
-		host := strings.ToLower(pu.Host)
-		if strings.Contains(host, "music.youtube.com") || strings.Contains(host, "open.spotify.com") {
-			slog.Debug("Player selected", "name", "firefox")
-			return fp, parserWithIDFunc(DefaultParser, urlIDFunc), nil
+		if _, ok := findMusicSite(pu.Host); ok {
+			found = append(found, candidate{playerName})
 		}
 	}
 
-	return nil, nil, errors.New("No player exists")
+	// Fallback: any other mpris player. Proxies are only followed when a
+	// --player pattern matches them.
+	for _, playerName := range players {
+		if isBrowser(playerName) || slices.ContainsFunc(found, func(c candidate) bool { return c.name == playerName }) {
+			continue
+		}
+		if isProxy(playerName) && matchIndex(config.Players, playerName) < 0 {
+			slog.Debug("Skipping proxy player", "player", playerName)
+			continue
+		}
+		found = append(found, candidate{playerName})
+	}
+
+	return found
+}
+
+// Select selects correct parses for player. Players matching --ignore-player
+// patterns are skipped. If --player patterns are set, only matching players
+// are selected, preferring players matching earlier patterns. Otherwise the
+// player which started playing most recently is selected, or the last active
+// one when none is playing.
+func Select(conn *dbus.Conn) (*mpris.Player, Parser, error) {
+	players, err := names(conn)
+	if err != nil {
+		return nil, nil, err
+	}
+	slog.Debug("Player names", "players", players)
+
+	if len(players) == 0 {
+		return nil, nil, errors.New("No player exists")
+	}
+
+	found := selectable(conn, candidates(conn, players))
+	if len(found) == 0 {
+		return nil, nil, errors.New("No player exists")
+	}
+
+	selected := found[0]
+	follow(selected.name)
+	strategy := strategyFor(selected.name)
+	slog.Debug("Player selected", "name", selected.name, "id-strategy", strategy)
+	return mpris.New(conn, selected.name), parserWithIDFunc(DefaultParser, IDStrategies[strategy]), nil
+}
+
+// ParserFor returns the parser Select uses for the player with given bus name
+func ParserFor(busName string) Parser {
+	return parserWithIDFunc(DefaultParser, IDStrategies[strategyFor(busName)])
+}
+
+// selectable removes players which are ignored or not allowed by --player
+// patterns and sorts the rest by priority
+func selectable(conn *dbus.Conn, found []candidate) []candidate {
+	found = slices.DeleteFunc(found, func(c candidate) bool {
+		if matchIndex(config.IgnorePlayers, c.name) >= 0 {
+			slog.Debug("Player ignored", "name", c.name)
+			return true
+		}
+		return len(config.Players) != 0 && matchIndex(config.Players, c.name) < 0
+	})
+
+	if len(found) != 0 {
+		order(conn, found)
+	}
+	return found
 }
 
 func parserWithIDFunc(f Parser, i IDFunc) Parser {
@@ -198,6 +456,12 @@ func DefaultParser(player *mpris.Player) (*Info, error) {
 	volume := should(player.GetVolume())
 	album := should(player.GetAlbum())
 
+	// Some players report zero rate while paused or don't support it
+	rate := should(player.GetRate())
+	if rate <= 0 {
+		rate = 1
+	}
+
 	urlStr := should(player.GetURL())
 	pu := should(url.Parse(urlStr))
 
@@ -242,6 +506,7 @@ func DefaultParser(player *mpris.Player) (*Info, error) {
 		ID:       trackid,
 		Length:   length,
 		Metadata: meta,
+		Rate:     rate,
 		Shuffle:  shuffle,
 		Status:   status,
 		Title:    title,
@@ -249,6 +514,8 @@ func DefaultParser(player *mpris.Player) (*Info, error) {
 		Volume:   volume,
 	}
 
+	info.Latency = LatencyFor(info)
+
 	err = info.UpdatePosition(player)
 	return info, err
 }
@@ -0,0 +1,327 @@
+package player
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/config"
+)
+
+func TestMatchIndex(t *testing.T) {
+	patterns := []string{"spotify", "firefox.*", "*music*"}
+
+	tests := []struct {
+		busName string
+		want    int
+	}{
+		{"org.mpris.MediaPlayer2.spotify", 0},
+		{"org.mpris.MediaPlayer2.firefox.instance_1_84", 1},
+		{"org.mpris.MediaPlayer2.YoutubeMusic", 2},
+		{"org.mpris.MediaPlayer2.amarok", -1},
+	}
+
+	for _, tt := range tests {
+		if got := matchIndex(patterns, tt.busName); got != tt.want {
+			t.Errorf("matchIndex(%q) = %d, want %d", tt.busName, got, tt.want)
+		}
+	}
+
+	if err := ValidatePatterns([]string{"spot[ify"}); err == nil {
+		t.Error("ValidatePatterns() accepted invalid pattern")
+	}
+}
+
+func TestStableTrackID(t *testing.T) {
+	tests := []struct {
+		trackid string
+		want    bool
+	}{
+		{"/com/spotify/track/4uLU6hMCjMI75M1A2tKUQC", true},
+		{"/org/ncspot/spotify/track/4uLU6hMCjMI75M1A2tKUQC", true},
+		{"/org/videolan/vlc/playlist/5", false},
+		{"/org/gnome/Rhythmbox3/Track/123", false},
+		{"/org/mpris/MediaPlayer2/TrackList/NoTrack", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := stableTrackID(tt.trackid); got != tt.want {
+			t.Errorf("stableTrackID(%q) = %v, want %v", tt.trackid, got, tt.want)
+		}
+	}
+}
+
+func TestIsBrowser(t *testing.T) {
+	tests := []struct {
+		busName string
+		want    bool
+	}{
+		{"org.mpris.MediaPlayer2.firefox.instance_1_84", true},
+		{"org.mpris.MediaPlayer2.chromium.instance2741", true},
+		{"org.mpris.MediaPlayer2.brave.instance10432", true},
+		{"org.mpris.MediaPlayer2.vivaldi.instance3120", true},
+		{"org.mpris.MediaPlayer2.msedge.instance8841", true},
+		{"org.mpris.MediaPlayer2.firefox", true},
+		{"org.mpris.MediaPlayer2.spotify", false},
+		{"org.mpris.MediaPlayer2.vlc", false},
+		{"org.mpris.MediaPlayer2.chromecast", false},
+		{"org.mpris.MediaPlayer2.edgeplayer.instance12", false},
+		{"org.mpris.MediaPlayer2.bravenewworld", false},
+		{"org.mpris.MediaPlayer2.firefox.extension", false},
+	}
+
+	for _, tt := range tests {
+		if got := isBrowser(tt.busName); got != tt.want {
+			t.Errorf("isBrowser(%q) = %v, want %v", tt.busName, got, tt.want)
+		}
+	}
+}
+
+func TestStrategyFor(t *testing.T) {
+	old := config.IDStrategies
+	config.IDStrategies = map[string]string{"vlc": "url"}
+	t.Cleanup(func() { config.IDStrategies = old })
+
+	tests := []struct {
+		busName string
+		want    string
+	}{
+		{"org.mpris.MediaPlayer2.spotify", "web"},
+		{"org.mpris.MediaPlayer2.amarok", "artist-title"},
+		{"org.mpris.MediaPlayer2.firefox.instance_1_84", "web"},
+		{"org.mpris.MediaPlayer2.mpv", "auto"},
+		{"org.mpris.MediaPlayer2.vlc", "url"},
+	}
+
+	for _, tt := range tests {
+		if got := strategyFor(tt.busName); got != tt.want {
+			t.Errorf("strategyFor(%q) = %q, want %q", tt.busName, got, tt.want)
+		}
+	}
+}
+
+func TestCandidatesSkipsProxies(t *testing.T) {
+	players := []string{
+		"org.mpris.MediaPlayer2.vlc",
+		"org.mpris.MediaPlayer2.playerctld",
+		"org.mpris.MediaPlayer2.spotify",
+	}
+	names := func() []string {
+		var names []string
+		for c := range slices.Values(candidates(nil, players)) {
+			names = append(names, ShortName(c.name))
+		}
+		return names
+	}
+
+	if got, want := names(), []string{"spotify", "vlc"}; !slices.Equal(got, want) {
+		t.Errorf("candidates() = %v, want %v", got, want)
+	}
+
+	old := config.Players
+	config.Players = []string{"playerctld"}
+	t.Cleanup(func() { config.Players = old })
+	if got := names(); !slices.Contains(got, "playerctld") {
+		t.Errorf("candidates() = %v, want playerctld when --player matches it", got)
+	}
+}
+
+func TestMusicSiteID(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://music.youtube.com/watch?v=dQw4w9WgXcQ&list=RD", "dQw4w9WgXcQ"},
+		{"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC", "4uLU6hMCjMI75M1A2tKUQC"},
+		{"https://soundcloud.com/artist/some-track", "artist/some-track"},
+		{"https://soundcloud.com/artist/sets", ""},
+		{"https://www.deezer.com/en/track/3135556", "3135556"},
+		{"https://listen.tidal.com/track/1234567", "1234567"},
+		{"https://tidal.com/browse/track/1234567", "1234567"},
+		{"https://artist.bandcamp.com/track/some-track", "some-track"},
+		{"https://music.apple.com/us/album/some-album/1440833098?i=1440833517", "1440833517"},
+		{"https://music.apple.com/us/song/some-song/1440833517", "1440833517"},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		site, ok := findMusicSite(u.Host)
+		if !ok {
+			t.Errorf("findMusicSite(%q) found no site", u.Host)
+			continue
+		}
+		if got := site.id(u); got != tt.want {
+			t.Errorf("id(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	if _, ok := findMusicSite("www.youtube.com"); ok {
+		t.Error("findMusicSite() matched unsupported site")
+	}
+}
+
+func TestActivityCompare(t *testing.T) {
+	a := newActivity()
+	start := time.Now()
+
+	a.update("spotify", mpris.PlaybackPlaying, start)
+	a.update("vlc", mpris.PlaybackPlaying, start.Add(time.Second))
+	a.update("mpv", mpris.PlaybackPaused, start.Add(2*time.Second))
+
+	if got := a.compare("vlc", "spotify"); got >= 0 {
+		t.Errorf("compare(vlc, spotify) = %d, want player which started playing later first", got)
+	}
+	if got := a.compare("spotify", "mpv"); got >= 0 {
+		t.Errorf("compare(spotify, mpv) = %d, want playing player first", got)
+	}
+
+	// Status updates without a change keep the start time
+	a.update("spotify", mpris.PlaybackPlaying, start.Add(3*time.Second))
+	if got := a.compare("vlc", "spotify"); got >= 0 {
+		t.Errorf("compare(vlc, spotify) = %d after repeated status, want vlc first", got)
+	}
+
+	// All paused: the last active player is first
+	a.update("vlc", mpris.PlaybackPaused, start.Add(4*time.Second))
+	a.update("spotify", mpris.PlaybackPaused, start.Add(5*time.Second))
+	if got := a.compare("spotify", "vlc"); got >= 0 {
+		t.Errorf("compare(spotify, vlc) = %d, want last active player first", got)
+	}
+}
+
+func TestLatencyFor(t *testing.T) {
+	defer func(offsets map[string]string, coarse []string) {
+		config.PlayerOffsets, config.CoarsePositions = offsets, coarse
+	}(config.PlayerOffsets, config.CoarsePositions)
+
+	config.PlayerOffsets = map[string]string{"spotify": "300ms", "*.deezer.com": "-100ms"}
+	config.CoarsePositions = []string{"YoutubeMusic", "music.youtube.com"}
+
+	tests := []struct {
+		player string
+		url    string
+		want   Latency
+	}{
+		{"org.mpris.MediaPlayer2.spotify", "", Latency{Offset: 300 * time.Millisecond}},
+		{"org.mpris.MediaPlayer2.YoutubeMusic", "", Latency{Coarse: true}},
+		{"org.mpris.MediaPlayer2.firefox.instance_1_84", "https://music.youtube.com/watch?v=abc", Latency{Coarse: true}},
+		{"org.mpris.MediaPlayer2.firefox.instance_1_84", "https://www.deezer.com/en/track/1", Latency{Offset: -100 * time.Millisecond}},
+		{"org.mpris.MediaPlayer2.vlc", "file:///music/song.flac", Latency{}},
+	}
+
+	for _, tt := range tests {
+		info := &Info{Player: tt.player}
+		if tt.url != "" {
+			info.URL, _ = url.Parse(tt.url)
+		}
+		if got := LatencyFor(info); got != tt.want {
+			t.Errorf("LatencyFor(%s, %s) = %+v, want %+v", tt.player, tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	start := time.Now()
+
+	// Position rounded to seconds, queried every 100ms
+	var samples []Sample
+	for i := range 50 {
+		elapsed := time.Duration(i) * 100 * time.Millisecond
+		samples = append(samples, Sample{
+			At:       start.Add(elapsed),
+			Position: (elapsed + 300*time.Millisecond).Truncate(time.Second),
+		})
+	}
+
+	c, err := Calibrate(samples)
+	if err != nil {
+		t.Fatalf("Calibrate() error = %v", err)
+	}
+	if !c.Latency.Coarse || c.Interval != time.Second {
+		t.Errorf("Calibrate() = %+v, want coarse position with 1s interval", c)
+	}
+
+	// Position updated every 500ms
+	samples = samples[:0]
+	for i := range 50 {
+		elapsed := time.Duration(i) * 100 * time.Millisecond
+		samples = append(samples, Sample{
+			At:       start.Add(elapsed),
+			Position: 10*time.Second + elapsed.Truncate(500*time.Millisecond) + time.Millisecond,
+		})
+	}
+
+	c, err = Calibrate(samples)
+	if err != nil {
+		t.Fatalf("Calibrate() error = %v", err)
+	}
+	if c.Latency.Coarse || c.Latency.Offset != 250*time.Millisecond {
+		t.Errorf("Calibrate() = %+v, want 250ms offset", c)
+	}
+
+	if _, err := Calibrate(samples[:3]); err != ErrFewSamples {
+		t.Errorf("Calibrate() with few samples error = %v, want ErrFewSamples", err)
+	}
+}
+
+func TestUnranked(t *testing.T) {
+	all := []candidate{{"org.mpris.MediaPlayer2.vlc"}}
+
+	tests := []struct {
+		name   string
+		host   string
+		state  string
+		reason string
+	}{
+		{"org.mpris.MediaPlayer2.vlc", "", StateIgnored, "doesn't match any --player pattern"},
+		{"org.mpris.MediaPlayer2.playerctld", "", StateUnsupported, "mpris proxy, follow it with --player"},
+		{"org.mpris.MediaPlayer2.firefox.instance_1_84", "", StateUnsupported, "browser has no page url"},
+		{"org.mpris.MediaPlayer2.firefox.instance_1_84", "example.com", StateUnsupported, "browser is not on a supported music site"},
+	}
+
+	for _, tt := range tests {
+		state, reason := unranked(tt.name, tt.host, all)
+		if state != tt.state || reason != tt.reason {
+			t.Errorf("unranked(%q, %q) = %s, %q, want %s, %q", tt.name, tt.host, state, reason, tt.state, tt.reason)
+		}
+	}
+}
+
+func TestRankReason(t *testing.T) {
+	ranked := []Report{
+		{Name: "spotify", Status: mpris.PlaybackPlaying},
+		{Name: "mpv", Status: mpris.PlaybackPaused},
+		{Name: "vlc", Status: mpris.PlaybackPlaying},
+	}
+
+	tests := []struct {
+		i       int
+		players []string
+		want    string
+	}{
+		{0, nil, "playing, followed by waybar-lyric"},
+		{1, nil, "not playing while spotify is"},
+		{2, nil, "lower priority than spotify"},
+		{0, []string{"spotify", "*"}, `matches --player pattern "spotify", playing, followed by waybar-lyric`},
+		{2, []string{"spotify", "*"}, `matches later --player pattern "*"`},
+	}
+
+	defer func(p []string) { config.Players = p }(config.Players)
+	for _, tt := range tests {
+		config.Players = tt.players
+		if got := rankReason(ranked, tt.i, "org.mpris.MediaPlayer2.spotify"); got != tt.want {
+			t.Errorf("rankReason(%d, %q) = %q, want %q", tt.i, tt.players, got, tt.want)
+		}
+	}
+
+	config.Players = nil
+	if got := rankReason(ranked[1:2], 0, ""); got != "only available player" {
+		t.Errorf("rankReason() = %q, want only available player", got)
+	}
+}
@@ -0,0 +1,146 @@
+package player
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/config"
+	"github.com/godbus/dbus/v5"
+)
+
+// Selection states of a player
+const (
+	StateSelected    = "selected"
+	StateSupported   = "supported"
+	StateIgnored     = "ignored"
+	StateUnsupported = "unsupported"
+)
+
+// Report describes a player on the bus and how Select treats it
+type Report struct {
+	Name       string               `json:"name"`
+	Status     mpris.PlaybackStatus `json:"status"`
+	Title      string               `json:"title"`
+	Artist     string               `json:"artist"`
+	Host       string               `json:"host"`
+	IDStrategy string               `json:"id_strategy"`
+	State      string               `json:"state"`
+	Reason     string               `json:"reason"`
+}
+
+// Describe reports every player on the bus. Players which can be selected are
+// listed first in priority order, the first one is the player Select would
+// choose.
+func Describe(conn *dbus.Conn) ([]Report, error) {
+	players, err := names(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	all := candidates(conn, players)
+	ranked := selectable(conn, slices.Clone(all))
+	followed := followedPlayer()
+
+	reports := make([]Report, 0, len(players))
+	for i, c := range ranked {
+		r := describe(conn, c.name)
+		r.IDStrategy = strategyFor(c.name)
+		r.State = StateSupported
+		if i == 0 {
+			r.State = StateSelected
+		}
+		reports = append(reports, r)
+	}
+	for i := range reports {
+		reports[i].Reason = rankReason(reports, i, followed)
+	}
+
+	for name := range slices.Values(players) {
+		if slices.ContainsFunc(ranked, func(c candidate) bool { return c.name == name }) {
+			continue
+		}
+
+		r := describe(conn, name)
+		r.IDStrategy = strategyFor(name)
+
+		r.State, r.Reason = unranked(name, r.Host, all)
+		reports = append(reports, r)
+	}
+
+	return reports, nil
+}
+
+// unranked returns the state of a player which can't be selected and why.
+// host is the host of the page url of browsers.
+func unranked(name, host string, all []candidate) (state, reason string) {
+	ignored := matchIndex(config.IgnorePlayers, name)
+	switch {
+	case ignored >= 0:
+		return StateIgnored, fmt.Sprintf("matches --ignore-player pattern %q", config.IgnorePlayers[ignored])
+	case slices.ContainsFunc(all, func(c candidate) bool { return c.name == name }):
+		return StateIgnored, "doesn't match any --player pattern"
+	case isProxy(name):
+		return StateUnsupported, "mpris proxy, follow it with --player"
+	case host == "":
+		return StateUnsupported, "browser has no page url"
+	default:
+		return StateUnsupported, "browser is not on a supported music site"
+	}
+}
+
+// describe reads status and track information of the player
+func describe(conn *dbus.Conn, name string) Report {
+	mp := mpris.New(conn, name)
+	r := Report{
+		Name:   ShortName(name),
+		Status: should(mp.GetPlaybackStatus()),
+		Title:  should(mp.GetTitle()),
+		Artist: strings.Join(should(mp.GetArtist()), ", "),
+	}
+	if u, err := url.Parse(should(mp.GetURL())); err == nil {
+		r.Host = u.Host
+	}
+	return r
+}
+
+// rankReason explains the position of the i-th player in ranked reports.
+// followed is the player followed by the main loop.
+func rankReason(ranked []Report, i int, followed string) string {
+	r := ranked[i]
+	pattern := matchIndex(config.Players, r.Name)
+	playing := r.Status == mpris.PlaybackPlaying
+	isFollowed := followed != "" && ShortName(followed) == r.Name
+
+	if i > 0 {
+		first := ranked[0]
+		switch {
+		case pattern > matchIndex(config.Players, first.Name):
+			return fmt.Sprintf("matches later --player pattern %q", config.Players[pattern])
+		case !playing && first.Status == mpris.PlaybackPlaying:
+			return "not playing while " + first.Name + " is"
+		default:
+			return "lower priority than " + first.Name
+		}
+	}
+
+	var reasons []string
+	if pattern >= 0 {
+		reasons = append(reasons, fmt.Sprintf("matches --player pattern %q", config.Players[pattern]))
+	}
+	if playing {
+		reasons = append(reasons, "playing")
+	}
+	if isFollowed {
+		reasons = append(reasons, "followed by waybar-lyric")
+	}
+	if len(reasons) == 0 {
+		if len(ranked) == 1 {
+			return "only available player"
+		}
+		return "first in default priority order"
+	}
+	return strings.Join(reasons, ", ")
+}
@@ -0,0 +1,170 @@
+package record
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/waybar"
+)
+
+// MaxLineSize is the maximum size of a recorded line read by Read
+const MaxLineSize = 4 * 1024 * 1024
+
+// Entry is a recorded output
+type Entry struct {
+	// Time is seconds since the recording started
+	Time float64 `json:"time"`
+	// Reason is why the main loop woke up before the output
+	Reason string `json:"reason"`
+	// Output is the printed line
+	Output string `json:"output"`
+	// Player is the followed player when the output was printed
+	Player json.RawMessage `json:"player,omitempty"`
+	// Waybar is the printed Waybar
+	Waybar json.RawMessage `json:"waybar,omitempty"`
+}
+
+// recorder writes outputs to the recording file. reason and info are kept
+// while not recording, so they're known when the recording starts.
+var recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	enc    *json.Encoder
+	start  time.Time
+	reason string
+	info   *player.Info
+}
+
+// Start records every printed output into the file, replacing it if it
+// exists. The returned function stops recording and closes the file.
+func Start(path string) (func() error, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	recorder.mu.Lock()
+	recorder.file = file
+	recorder.enc = json.NewEncoder(file)
+	recorder.enc.SetEscapeHTML(false)
+	recorder.start = time.Now()
+	recorder.mu.Unlock()
+
+	waybar.Hook = add
+	slog.Info("Recording output", "file", path)
+
+	return func() error {
+		waybar.Hook = nil
+
+		recorder.mu.Lock()
+		defer recorder.mu.Unlock()
+		err := recorder.file.Close()
+		recorder.file, recorder.enc = nil, nil
+		return err
+	}, nil
+}
+
+// Wake sets the reason of following outputs
+func Wake(reason string) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.reason = reason
+}
+
+// Follow sets the player information included in following outputs. info is
+// read when an output is recorded, nil means no player is followed.
+func Follow(info *player.Info) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.info = info
+}
+
+// add records the output. Entries are written unbuffered, so the recording
+// is usable even if waybar-lyric is killed.
+func add(w *waybar.Waybar, line string) {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	if recorder.enc == nil {
+		return
+	}
+
+	e := Entry{
+		Time:   time.Since(recorder.start).Seconds(),
+		Reason: recorder.reason,
+		Output: line,
+	}
+	if recorder.info != nil {
+		e.Player = marshal(*recorder.info)
+	}
+	if w != waybar.Zero {
+		e.Waybar = marshal(w)
+	}
+
+	if err := recorder.enc.Encode(e); err != nil {
+		slog.Error("Failed to record output", "error", err)
+	}
+}
+
+// marshal encodes v without escaping html, tooltips contain pango markup
+func marshal(v any) json.RawMessage {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		slog.Warn("Failed to encode recorded value", "error", err)
+		return nil
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+// Read calls fn with every entry of the recording in order
+func Read(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxLineSize)
+
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("invalid entry on line %d: %w", n, err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Replay prints outputs of the recording with the original timing until the
+// recording ends or ctx is done
+func Replay(ctx context.Context, r io.Reader) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	start := time.Now()
+	return Read(r, func(e Entry) error {
+		at := time.Duration(e.Time * float64(time.Second))
+		timer.Reset(time.Until(start.Add(at)))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		slog.Info("Replaying output", "at", at.String(), "reason", e.Reason)
+		fmt.Println(e.Output)
+		return nil
+	})
+}
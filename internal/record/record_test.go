@@ -0,0 +1,82 @@
+package record
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/waybar"
+)
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+
+	stop, err := Start(path)
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	Wake("lyric-timer")
+	Follow(&player.Info{Player: "org.mpris.MediaPlayer2.test", Title: "Song", Length: time.Minute})
+	w := &waybar.Waybar{Text: "first <line>", Alt: waybar.Lyric, Class: waybar.Class{waybar.Lyric}}
+	w.Encode()
+
+	Wake("owner-changed")
+	Follow(nil)
+	waybar.Zero.Encode()
+
+	if err := stop(); err != nil {
+		t.Fatalf("stop() error = %v", err)
+	}
+	if waybar.Hook != nil {
+		t.Error("stop() didn't remove waybar hook")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	err = Read(file, func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("Read() returned %d entries, want 2", len(entries))
+	}
+
+	first := entries[0]
+	if first.Reason != "lyric-timer" || !strings.Contains(first.Output, `"text":"first <line>"`) {
+		t.Errorf("first entry = %+v", first)
+	}
+	if !strings.Contains(string(first.Player), `"title":"Song"`) {
+		t.Errorf("first entry player = %s", first.Player)
+	}
+	if first.Waybar == nil {
+		t.Error("first entry has no waybar")
+	}
+
+	second := entries[1]
+	if second.Reason != "owner-changed" || second.Output != "{}" || second.Player != nil || second.Waybar != nil {
+		t.Errorf("second entry = %+v", second)
+	}
+	if second.Time < first.Time {
+		t.Errorf("entries are not in order: %f < %f", second.Time, first.Time)
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	err := Read(strings.NewReader("{\"time\":0,\"output\":\"{}\"}\n\nnot json\n"), func(Entry) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("Read() error = %v, want error on line 3", err)
+	}
+}
@@ -0,0 +1,193 @@
+package simulate
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/fake"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+	"github.com/Nadim147c/waybar-lyric/internal/waybar"
+)
+
+const (
+	// Player is the player name shown in detailed output
+	Player = "simulate"
+	// UnknownArtist is the artist when the LRC file has no artist tag
+	UnknownArtist = "Unknown Artist"
+)
+
+const (
+	// GettingFor is how long lyrics are fetched before a track starts
+	GettingFor = time.Second
+	// PauseFor is how long the track is paused
+	PauseFor = 5 * time.Second
+	// NoLyricFor is how long the track without lyrics plays
+	NoLyricFor = 5 * time.Second
+)
+
+// Frame is an output at a virtual time from the start of a cycle
+type Frame struct {
+	At     time.Duration
+	Waybar *waybar.Waybar
+}
+
+// Scenario is a simulation cycle. Lyrics are fetched, the track plays and
+// pauses at PauseAt for a while, then a track without lyrics plays before the
+// cycle starts again.
+type Scenario struct {
+	Track   fake.Track
+	Lyrics  shared.Lyrics
+	PauseAt time.Duration
+}
+
+// New creates a scenario for the LRC file. The track pauses at the middle
+// when pauseAt is zero.
+func New(path string, pauseAt time.Duration) (Scenario, error) {
+	track, lyrics, err := fake.Load(path)
+	if err != nil {
+		return Scenario{}, err
+	}
+	track.Artist = cmp.Or(track.Artist, UnknownArtist)
+	if err := track.Validate(lyrics); err != nil {
+		return Scenario{}, err
+	}
+
+	if pauseAt == 0 {
+		pauseAt = track.Length / 2
+	}
+	if pauseAt < 0 || pauseAt >= track.Length {
+		return Scenario{}, fmt.Errorf("pause position %s is outside of the track (length=%s)", pauseAt, track.Length)
+	}
+
+	lyric.CensorLyrics(lyrics)
+	lyric.SimplifyLyrics(lyrics)
+	return Scenario{Track: track, Lyrics: lyrics, PauseAt: pauseAt}, nil
+}
+
+// ParseSpeed parses simulation speed, e.g. 2x, 0.5x or 2
+func ParseSpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(s), "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid speed %q", s)
+	}
+	return speed, nil
+}
+
+// Duration returns the virtual duration of a cycle
+func (s Scenario) Duration() time.Duration {
+	return 2*GettingFor + s.Track.Length + PauseFor + NoLyricFor
+}
+
+// info returns player information of the track at the position
+func info(track fake.Track, pos time.Duration, status mpris.PlaybackStatus) *player.Info {
+	return &player.Info{
+		Player:   mpris.BaseInterface + "." + Player,
+		ID:       string(track.TrackID()),
+		Artist:   track.Artist,
+		Title:    track.Title,
+		Album:    track.Album,
+		Length:   track.Length,
+		Position: pos,
+		Rate:     1,
+		Volume:   1,
+		Status:   status,
+	}
+}
+
+// getting returns the output while lyrics of the track are fetched
+func getting(track fake.Track) *waybar.Waybar {
+	w := waybar.ForPlayer(info(track, 0, mpris.PlaybackPlaying))
+	w.Alt = waybar.Getting
+	w.Class = append(w.Class, waybar.Getting)
+	return w
+}
+
+// Frames returns outputs of a cycle in order
+func (s Scenario) Frames() []Frame {
+	frames := []Frame{{0, getting(s.Track)}}
+
+	add := func(at, pos time.Duration, status mpris.PlaybackStatus) {
+		w, _ := waybar.ForPosition(info(s.Track, pos, status), s.Lyrics)
+		frames = append(frames, Frame{GettingFor + at, w})
+	}
+
+	paused := false
+	for line := range slices.Values(s.Lyrics) {
+		if !paused && line.Timestamp >= s.PauseAt {
+			paused = true
+			add(s.PauseAt, s.PauseAt, mpris.PlaybackPaused)
+			add(s.PauseAt+PauseFor, s.PauseAt, mpris.PlaybackPlaying)
+		}
+
+		at := line.Timestamp
+		if paused {
+			at += PauseFor
+		}
+		// Lines are shown once position passes the timestamp
+		add(at, line.Timestamp+1, mpris.PlaybackPlaying)
+	}
+	if !paused {
+		add(s.PauseAt, s.PauseAt, mpris.PlaybackPaused)
+		add(s.PauseAt+PauseFor, s.PauseAt, mpris.PlaybackPlaying)
+	}
+
+	end := GettingFor + s.Track.Length + PauseFor
+	instrumental := fake.Track{
+		Title:  s.Track.Title + " (Instrumental)",
+		Artist: s.Track.Artist,
+		Album:  s.Track.Album,
+		Length: s.Track.Length,
+	}
+	noLyric := waybar.ForPlayer(info(instrumental, 0, mpris.PlaybackPlaying))
+	noLyric.Alt = waybar.NoLyric
+
+	return append(frames,
+		Frame{end, getting(instrumental)},
+		Frame{end + GettingFor, noLyric},
+	)
+}
+
+// Run prints outputs of the scenario in cycles until ctx is done. Virtual time
+// passes speed times faster than real time.
+func Run(ctx context.Context, s Scenario, speed float64) error {
+	frames := s.Frames()
+	slog.Info("Simulating lyrics",
+		"title", s.Track.Title,
+		"artist", s.Track.Artist,
+		"length", s.Track.Length.String(),
+		"pause-at", s.PauseAt.String(),
+		"speed", speed,
+	)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	start := time.Now()
+	var last *waybar.Waybar
+	for cycle := time.Duration(0); ; cycle++ {
+		for f := range slices.Values(frames) {
+			at := cycle*s.Duration() + f.At
+			timer.Reset(time.Until(start.Add(time.Duration(float64(at) / speed))))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-timer.C:
+			}
+
+			if !f.Waybar.Is(last) {
+				slog.Debug("Simulated output", "at", at.String(), "alt", f.Waybar.Alt, "text", f.Waybar.Text)
+				f.Waybar.Encode()
+				last = f.Waybar
+			}
+		}
+	}
+}
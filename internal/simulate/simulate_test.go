@@ -0,0 +1,86 @@
+package simulate
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/fake"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+	"github.com/Nadim147c/waybar-lyric/internal/waybar"
+)
+
+func TestFrames(t *testing.T) {
+	s := Scenario{
+		Track: fake.Track{Title: "Song", Artist: "Artist", Length: 20 * time.Second},
+		Lyrics: shared.Lyrics{
+			{},
+			{Timestamp: 2 * time.Second, Text: "one"},
+			{Timestamp: 6 * time.Second, Text: "two"},
+			{Timestamp: 12 * time.Second, Text: "three"},
+		},
+		PauseAt: 8 * time.Second,
+	}
+
+	type want struct {
+		at   time.Duration
+		alt  waybar.Status
+		text string
+	}
+	wants := []want{
+		{0, waybar.Getting, "Artist - Song"},
+		{1 * time.Second, waybar.Music, "Artist - Song"},
+		{3 * time.Second, waybar.Lyric, "one"},
+		{7 * time.Second, waybar.Lyric, "two"},
+		{9 * time.Second, waybar.Paused, "Artist - Song"},
+		{14 * time.Second, waybar.Lyric, "two"},
+		{18 * time.Second, waybar.Lyric, "three"},
+		{26 * time.Second, waybar.Getting, "Artist - Song (Instrumental)"},
+		{27 * time.Second, waybar.NoLyric, "Artist - Song (Instrumental)"},
+	}
+
+	frames := s.Frames()
+	if len(frames) != len(wants) {
+		t.Fatalf("Frames() returned %d frames, want %d", len(frames), len(wants))
+	}
+	for i, f := range frames {
+		w := wants[i]
+		if f.At != w.at || f.Waybar.Alt != w.alt || f.Waybar.Text != w.text {
+			t.Errorf("frame %d = (%s, %s, %q), want (%s, %s, %q)", i, f.At, f.Waybar.Alt, f.Waybar.Text, w.at, w.alt, w.text)
+		}
+	}
+
+	if !slices.IsSortedFunc(frames, func(a, b Frame) int { return int(a.At - b.At) }) {
+		t.Error("frames are not in order")
+	}
+	if last := frames[len(frames)-1].At; last >= s.Duration() {
+		t.Errorf("last frame at %s is after the end of the cycle %s", last, s.Duration())
+	}
+}
+
+func TestParseSpeed(t *testing.T) {
+	tests := []struct {
+		speed   string
+		want    float64
+		wantErr bool
+	}{
+		{speed: "2x", want: 2},
+		{speed: "0.5x", want: 0.5},
+		{speed: "3", want: 3},
+		{speed: "0x", wantErr: true},
+		{speed: "-1x", wantErr: true},
+		{speed: "fast", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.speed, func(t *testing.T) {
+			got, err := ParseSpeed(tt.speed)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSpeed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSpeed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/config"
+)
+
+// PollInterval is the time between default sink checks when pactl subscribe
+// is not available
+const PollInterval = 10 * time.Second
+
+// ErrNoSink is returned when the default audio sink can't be found
+var ErrNoSink = errors.New("default audio sink not found")
+
+// Sink is an audio output
+type Sink struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Class is the kind of output, e.g. bluez for Bluetooth devices
+	Class string `json:"class"`
+}
+
+// class returns the class of the sink from its name and device api
+func class(name, api string) string {
+	if strings.HasPrefix(api, "bluez") || strings.HasPrefix(name, "bluez") {
+		return "bluez"
+	}
+	return api
+}
+
+// pactlSink is a sink in `pactl --format=json list sinks` output
+type pactlSink struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Properties  map[string]string `json:"properties"`
+}
+
+// parsePactl finds the default sink from `pactl --format=json info` and
+// `pactl --format=json list sinks` outputs
+func parsePactl(info, sinks []byte) (Sink, error) {
+	var server struct {
+		DefaultSink string `json:"default_sink_name"`
+	}
+	if err := json.Unmarshal(info, &server); err != nil {
+		return Sink{}, fmt.Errorf("failed to decode pactl info: %w", err)
+	}
+
+	var list []pactlSink
+	if err := json.Unmarshal(sinks, &list); err != nil {
+		return Sink{}, fmt.Errorf("failed to decode pactl sinks: %w", err)
+	}
+
+	for s := range slices.Values(list) {
+		if s.Name == server.DefaultSink {
+			return Sink{
+				Name:        s.Name,
+				Description: s.Description,
+				Class:       class(s.Name, s.Properties["device.api"]),
+			}, nil
+		}
+	}
+
+	return Sink{}, ErrNoSink
+}
+
+// pwObject is an object in pw-dump output
+type pwObject struct {
+	Type string `json:"type"`
+	Info struct {
+		Props map[string]any `json:"props"`
+	} `json:"info"`
+	Props    map[string]any `json:"props"`
+	Metadata []struct {
+		Key   string `json:"key"`
+		Value any    `json:"value"`
+	} `json:"metadata"`
+}
+
+// parsePwDump finds the default sink from pw-dump output
+func parsePwDump(dump []byte) (Sink, error) {
+	var objects []pwObject
+	if err := json.Unmarshal(dump, &objects); err != nil {
+		return Sink{}, fmt.Errorf("failed to decode pw-dump: %w", err)
+	}
+
+	var name string
+	for o := range slices.Values(objects) {
+		if o.Type != "PipeWire:Interface:Metadata" || o.Props["metadata.name"] != "default" {
+			continue
+		}
+		for m := range slices.Values(o.Metadata) {
+			if m.Key != "default.audio.sink" {
+				continue
+			}
+			if v, ok := m.Value.(map[string]any); ok {
+				name, _ = v["name"].(string)
+			}
+		}
+	}
+
+	for o := range slices.Values(objects) {
+		props := o.Info.Props
+		if o.Type != "PipeWire:Interface:Node" || props["media.class"] != "Audio/Sink" {
+			continue
+		}
+		if props["node.name"] != name {
+			continue
+		}
+		description, _ := props["node.description"].(string)
+		api, _ := props["device.api"].(string)
+		return Sink{Name: name, Description: description, Class: class(name, api)}, nil
+	}
+
+	return Sink{}, ErrNoSink
+}
+
+// Default returns the default audio sink using pactl, or pw-dump when pactl
+// is not available
+func Default() (Sink, error) {
+	info, err := exec.Command("pactl", "--format=json", "info").Output()
+	if err == nil {
+		sinks, err := exec.Command("pactl", "--format=json", "list", "sinks").Output()
+		if err != nil {
+			return Sink{}, fmt.Errorf("failed to list sinks: %w", err)
+		}
+		return parsePactl(info, sinks)
+	}
+	slog.Debug("Failed to run pactl, trying pw-dump", "error", err)
+
+	dump, err := exec.Command("pw-dump").Output()
+	if err != nil {
+		return Sink{}, fmt.Errorf("failed to run pw-dump: %w", err)
+	}
+	return parsePwDump(dump)
+}
+
+// ValidateOffsets checks if per sink offsets are valid
+func ValidateOffsets(offsets map[string]string) error {
+	for pattern, offset := range offsets {
+		if _, err := time.ParseDuration(offset); err != nil {
+			return fmt.Errorf("invalid sink offset %q for %q: %w", offset, pattern, err)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid sink pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Delay returns the --sink-offset of the sink. Patterns are matched against
+// sink name first and then against its class, in sorted order.
+func Delay(s Sink) time.Duration {
+	patterns := slices.Sorted(maps.Keys(config.SinkOffsets))
+	for value := range slices.Values([]string{s.Name, s.Class}) {
+		if value == "" {
+			continue
+		}
+		for pattern := range slices.Values(patterns) {
+			if ok, _ := path.Match(pattern, value); ok {
+				// Offsets are validated on startup
+				d, _ := time.ParseDuration(config.SinkOffsets[pattern])
+				return d
+			}
+		}
+	}
+	return 0
+}
+
+var (
+	mu       sync.Mutex
+	current  Sink
+	detected bool
+)
+
+// CurrentDelay returns the --sink-offset of the default sink. The sink is
+// detected on first use unless Watch keeps it up to date.
+func CurrentDelay() time.Duration {
+	if len(config.SinkOffsets) == 0 {
+		return 0
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if !detected {
+		s, err := Default()
+		if err != nil {
+			slog.Warn("Failed to detect audio sink", "error", err)
+		}
+		current, detected = s, true
+	}
+
+	return Delay(current)
+}
+
+// Watch keeps the default sink up to date until ctx is done. The returned
+// channel receives the sink when it changes.
+func Watch(ctx context.Context) <-chan Sink {
+	changes := make(chan Sink, 1)
+	if len(config.SinkOffsets) == 0 {
+		return changes
+	}
+
+	update := func() {
+		s, err := Default()
+		if err != nil {
+			slog.Debug("Failed to detect audio sink", "error", err)
+			return
+		}
+
+		mu.Lock()
+		changed := !detected || s != current
+		current, detected = s, true
+		mu.Unlock()
+
+		if !changed {
+			return
+		}
+		slog.Info("Audio sink changed", "name", s.Name, "class", s.Class, "delay", Delay(s))
+		select {
+		case changes <- s:
+		case <-ctx.Done():
+		}
+	}
+
+	go func() {
+		update()
+
+		events := subscribe(ctx)
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-events:
+				if !ok {
+					events = nil // Poll when pactl subscribe exits
+					continue
+				}
+				update()
+			case <-ticker.C:
+				if events == nil {
+					update()
+				}
+			}
+		}
+	}()
+
+	return changes
+}
+
+// subscribe returns a channel which receives pactl server and sink events.
+// It returns nil if pactl is not available.
+func subscribe(ctx context.Context) <-chan struct{} {
+	cmd := exec.CommandContext(ctx, "pactl", "subscribe")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		slog.Debug("Failed to subscribe to pactl events", "error", err)
+		return nil
+	}
+
+	events := make(chan struct{}, 1)
+	go func() {
+		defer close(events)
+		defer cmd.Wait()
+
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			// e.g. Event 'change' on server #42
+			line := scanner.Text()
+			if !strings.Contains(line, " on server") && !strings.Contains(line, "'new' on sink") && !strings.Contains(line, "'remove' on sink") {
+				continue
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return events
+}
@@ -0,0 +1,73 @@
+package sink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/config"
+)
+
+func TestParsePactl(t *testing.T) {
+	info := []byte(`{"server_name":"PulseAudio (on PipeWire 1.2.7)","default_sink_name":"bluez_output.00_1B_66_AA_BB_CC.1"}`)
+	sinks := []byte(`[
+		{"index":50,"state":"SUSPENDED","name":"alsa_output.pci-0000_00_1f.3.analog-stereo","description":"Built-in Audio Analog Stereo","properties":{"device.api":"alsa"}},
+		{"index":71,"state":"RUNNING","name":"bluez_output.00_1B_66_AA_BB_CC.1","description":"WH-1000XM4","properties":{"device.api":"bluez5"}}
+	]`)
+
+	got, err := parsePactl(info, sinks)
+	if err != nil {
+		t.Fatalf("parsePactl() error = %v", err)
+	}
+	want := Sink{Name: "bluez_output.00_1B_66_AA_BB_CC.1", Description: "WH-1000XM4", Class: "bluez"}
+	if got != want {
+		t.Errorf("parsePactl() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParsePwDump(t *testing.T) {
+	dump := []byte(`[
+		{"id":0,"type":"PipeWire:Interface:Metadata","props":{"metadata.name":"default"},"metadata":[
+			{"subject":0,"key":"default.audio.sink","type":"Spa:String:JSON","value":{"name":"alsa_output.usb-Focusrite_Scarlett.analog-stereo"}}
+		]},
+		{"id":40,"type":"PipeWire:Interface:Node","info":{"props":{"node.name":"alsa_output.pci-0000_00_1f.3.analog-stereo","media.class":"Audio/Sink","device.api":"alsa"}}},
+		{"id":41,"type":"PipeWire:Interface:Node","info":{"props":{"node.name":"alsa_output.usb-Focusrite_Scarlett.analog-stereo","node.description":"Scarlett 2i2","media.class":"Audio/Sink","device.api":"alsa"}}}
+	]`)
+
+	got, err := parsePwDump(dump)
+	if err != nil {
+		t.Fatalf("parsePwDump() error = %v", err)
+	}
+	want := Sink{Name: "alsa_output.usb-Focusrite_Scarlett.analog-stereo", Description: "Scarlett 2i2", Class: "alsa"}
+	if got != want {
+		t.Errorf("parsePwDump() = %+v, want %+v", got, want)
+	}
+
+	if _, err := parsePwDump([]byte(`[]`)); err != ErrNoSink {
+		t.Errorf("parsePwDump() without default sink error = %v, want ErrNoSink", err)
+	}
+}
+
+func TestDelay(t *testing.T) {
+	defer func(offsets map[string]string) { config.SinkOffsets = offsets }(config.SinkOffsets)
+	config.SinkOffsets = map[string]string{
+		"bluez":                "200ms",
+		"bluez_output.00_1B_*": "300ms",
+		"alsa_output.usb-*":    "20ms",
+	}
+
+	tests := []struct {
+		sink Sink
+		want time.Duration
+	}{
+		{Sink{Name: "bluez_output.00_1B_66_AA_BB_CC.1", Class: "bluez"}, 300 * time.Millisecond},
+		{Sink{Name: "bluez_output.11_22_33_44_55_66.1", Class: "bluez"}, 200 * time.Millisecond},
+		{Sink{Name: "alsa_output.usb-Focusrite_Scarlett.analog-stereo", Class: "alsa"}, 20 * time.Millisecond},
+		{Sink{Name: "alsa_output.pci-0000_00_1f.3.analog-stereo", Class: "alsa"}, 0},
+	}
+
+	for _, tt := range tests {
+		if got := Delay(tt.sink); got != tt.want {
+			t.Errorf("Delay(%s) = %v, want %v", tt.sink.Name, got, tt.want)
+		}
+	}
+}
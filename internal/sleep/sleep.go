@@ -0,0 +1,136 @@
+package sleep
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/state"
+)
+
+// State is the name of the sleep timer state file
+const State = "sleep"
+
+// DefaultFade is the default time to fade out volume before pausing
+const DefaultFade = 10 * time.Second
+
+// Grace is how long a duration timer is kept after it ends. Older timers were
+// left behind while waybar-lyric wasn't running and are removed.
+const Grace = time.Minute
+
+// Timer pauses the player after a duration or at the end of a number of
+// tracks. It's enforced by the running waybar-lyric.
+type Timer struct {
+	// Set is when the timer was set
+	Set time.Time `json:"set"`
+	// Until is when the player is paused by a duration timer
+	Until time.Time `json:"until,omitzero"`
+	// Tracks is the number of tracks to play before pausing, including the
+	// current one
+	Tracks int `json:"tracks,omitempty"`
+	// Track is the ID of the current track of a track timer
+	Track string `json:"track,omitempty"`
+	// Fade is how long volume fades out before pausing
+	Fade time.Duration `json:"fade"`
+}
+
+// Load returns the sleep timer or nil if there is no timer. Duration timers
+// which ended more than Grace ago are removed.
+func Load() (*Timer, error) {
+	var t Timer
+	err := state.Load(State, &t)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sleep timer: %w", err)
+	}
+
+	if !t.Until.IsZero() && time.Since(t.Until) > Grace {
+		slog.Info("Removing expired sleep timer", "until", t.Until)
+		if err := Cancel(); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &t, nil
+}
+
+// Save saves the sleep timer
+func (t *Timer) Save() error {
+	if err := state.Save(State, t); err != nil {
+		return fmt.Errorf("failed to save sleep timer: %w", err)
+	}
+	return nil
+}
+
+// Cancel removes the sleep timer
+func Cancel() error {
+	if err := state.Remove(State); err != nil {
+		return fmt.Errorf("failed to remove sleep timer: %w", err)
+	}
+	return nil
+}
+
+// Advance counts a track of a track timer when the track id changes. It
+// reports whether the timer has changed.
+func (t *Timer) Advance(id string) bool {
+	if !t.Until.IsZero() || id == "" || id == t.Track {
+		return false
+	}
+	if t.Track != "" {
+		t.Tracks--
+	}
+	t.Track = id
+	return true
+}
+
+// Deadline returns when the player should be paused. left is the real time
+// until the end of current track. It returns zero time when the deadline is
+// not known yet.
+func (t *Timer) Deadline(left time.Duration, now time.Time) time.Time {
+	switch {
+	case !t.Until.IsZero():
+		return t.Until
+	case t.Tracks <= 0:
+		return now
+	case t.Tracks == 1:
+		return now.Add(max(left, 0))
+	default:
+		return time.Time{}
+	}
+}
+
+// Pause fades out the player volume over fade, pauses the player and restores
+// the volume. The volume is restored without pausing if ctx is done first.
+func Pause(ctx context.Context, mp *mpris.Player, fade time.Duration) error {
+	volume, err := mp.GetVolume()
+	if err != nil {
+		slog.Warn("Failed to get volume, pausing without fading", "error", err)
+		fade = 0
+	}
+
+	if fade > 0 {
+		if err := player.Fade(ctx, mp, 0, fade); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Warn("Failed to fade out volume", "error", err)
+		}
+	}
+
+	if ctx.Err() == nil {
+		if err := mp.Pause(); err != nil {
+			return fmt.Errorf("failed to pause player: %w", err)
+		}
+	}
+
+	if fade > 0 {
+		if err := mp.SetVolume(volume); err != nil {
+			return fmt.Errorf("failed to restore volume: %w", err)
+		}
+	}
+	return nil
+}
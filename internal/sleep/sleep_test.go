@@ -0,0 +1,89 @@
+package sleep
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/state"
+)
+
+func TestTimerTracks(t *testing.T) {
+	now := time.Now()
+	left := 30 * time.Second
+	timer := &Timer{Tracks: 2}
+
+	if !timer.Advance("a") {
+		t.Fatal("Advance() didn't record current track")
+	}
+	if timer.Tracks != 2 {
+		t.Errorf("Tracks = %d after first track, want 2", timer.Tracks)
+	}
+	if timer.Advance("a") {
+		t.Error("Advance() changed timer for the same track")
+	}
+	if got := timer.Deadline(left, now); !got.IsZero() {
+		t.Errorf("Deadline() = %v with 2 tracks left, want zero", got)
+	}
+
+	timer.Advance("b")
+	if got, want := timer.Deadline(left, now), now.Add(left); !got.Equal(want) {
+		t.Errorf("Deadline() = %v on last track, want end of track %v", got, want)
+	}
+
+	// Track changed before the deadline, e.g. skipped by user
+	timer.Advance("c")
+	if got := timer.Deadline(left, now); !got.Equal(now) {
+		t.Errorf("Deadline() = %v after last track, want now", got)
+	}
+}
+
+func TestTimerDuration(t *testing.T) {
+	now := time.Now()
+	timer := &Timer{Until: now.Add(time.Minute)}
+
+	if timer.Advance("a") {
+		t.Error("Advance() changed duration timer")
+	}
+	if got := timer.Deadline(time.Second, now); !got.Equal(timer.Until) {
+		t.Errorf("Deadline() = %v, want %v", got, timer.Until)
+	}
+}
+
+func TestLoadExpired(t *testing.T) {
+	state.Dir = t.TempDir()
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		until time.Time
+		kept  bool
+	}{
+		{"pending", now.Add(time.Minute), true},
+		{"within grace", now.Add(-Grace / 2), true},
+		{"expired", now.Add(-2 * Grace), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timer := &Timer{Set: now.Add(-time.Hour), Until: tt.until}
+			if err := timer.Save(); err != nil {
+				t.Fatalf("Save() failed: %v", err)
+			}
+
+			loaded, err := Load()
+			if err != nil {
+				t.Fatalf("Load() failed: %v", err)
+			}
+			if (loaded != nil) != tt.kept {
+				t.Errorf("Load() = %v, want kept=%t", loaded, tt.kept)
+			}
+
+			_, err = os.Stat(state.Path(State))
+			if exists := !errors.Is(err, os.ErrNotExist); exists != tt.kept {
+				t.Errorf("State file exists=%t, want %t", exists, tt.kept)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// PollInterval is the time between state file checks in Watch
+const PollInterval = time.Second
+
+// Dir is waybar-lyric state dir. State files are shared between the running
+// waybar-lyric instances and subcommands.
+var Dir string
+
+func init() {
+	stateHome := os.Getenv("XDG_STATE_HOME")
+	if stateHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			slog.Error("Failed to find state directory", "error", err)
+			return
+		}
+		stateHome = filepath.Join(home, ".local", "state")
+	}
+
+	Dir = filepath.Join(stateHome, "waybar-lyric")
+
+	if err := os.MkdirAll(Dir, 0755); err != nil {
+		slog.Error("Failed to create state directory")
+	}
+}
+
+// Path returns path of the state file
+func Path(name string) string {
+	return filepath.Join(Dir, name+".json")
+}
+
+// Load decodes the state file into v. It returns an error wrapping
+// os.ErrNotExist if the state file doesn't exist.
+func Load(name string, v any) error {
+	content, err := os.ReadFile(Path(name))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// Save encodes v into the state file. The file is replaced atomically.
+func Save(name string, v any) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(Dir, name+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name()) // no-op after successful rename
+	defer file.Close()
+
+	if _, err := file.Write(content); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), Path(name))
+}
+
+// Remove removes the state file if it exists
+func Remove(name string) error {
+	err := os.Remove(Path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// modTime returns modification time of the state file or zero time if it
+// doesn't exist
+func modTime(name string) time.Time {
+	info, err := os.Stat(Path(name))
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// Watch sends the name of a state file when it's saved or removed, until ctx
+// is done
+func Watch(ctx context.Context, names ...string) <-chan string {
+	changes := make(chan string, len(names))
+
+	last := map[string]time.Time{}
+	for name := range slices.Values(names) {
+		last[name] = modTime(name)
+	}
+
+	go func() {
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			for name := range slices.Values(names) {
+				t := modTime(name)
+				if t.Equal(last[name]) {
+					continue
+				}
+				last[name] = t
+				select {
+				case changes <- name:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return changes
+}
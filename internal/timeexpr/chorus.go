@@ -0,0 +1,49 @@
+package timeexpr
+
+import (
+	"strings"
+
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+// choruses returns indexes of lines which start a repeated part of the
+// lyrics. A part is repeated when a pair of consecutive lines appears more
+// than once, which avoids treating single repeated lines as a chorus.
+func choruses(lyrics shared.Lyrics) []int {
+	type pair struct{ first, second string }
+
+	pairAt := func(i int) (pair, bool) {
+		if i < 0 || i+1 >= len(lyrics) {
+			return pair{}, false
+		}
+		p := pair{normalize(lyrics[i].Text), normalize(lyrics[i+1].Text)}
+		return p, p.first != "" && p.second != ""
+	}
+
+	count := map[pair]int{}
+	for i := range lyrics {
+		if p, ok := pairAt(i); ok {
+			count[p]++
+		}
+	}
+
+	repeated := func(i int) bool {
+		p, ok := pairAt(i)
+		return ok && count[p] > 1
+	}
+
+	var starts []int
+	for i := range lyrics {
+		if repeated(i) && !repeated(i-1) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// normalize makes lines with different case and punctuation comparable
+func normalize(line string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(line), func(r rune) bool {
+		return !('a' <= r && r <= 'z') && !('0' <= r && r <= '9') && r < 128
+	}), " ")
+}
@@ -0,0 +1,327 @@
+package timeexpr
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Nadim147c/go-mpris"
+	"github.com/Nadim147c/waybar-lyric/internal/lyric"
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+var (
+	// ErrOutOfRange is returned when an expression points to a lyrics line
+	// which doesn't exist
+	ErrOutOfRange = errors.New("line number out of range")
+	// ErrNoChorus is returned when there is no chorus after current line
+	ErrNoChorus = errors.New("no chorus after current line")
+	// ErrNoLength is returned when track length is required but unknown
+	ErrNoLength = errors.New("track length is unknown")
+)
+
+// kind is the kind of time expression
+type kind int
+
+const (
+	kindTime      kind = iota // 1:23, 20s or 20
+	kindPercent               // 50%
+	kindLine                  // line:12
+	kindLines                 // +2lines
+	kindChorus                // next-chorus
+	kindLineStart             // start-of-line
+)
+
+// Expr is a parsed time expression
+type Expr struct {
+	kind kind
+	// sign is -1 or 1 if the expression has an explicit sign, otherwise 0
+	sign    int
+	time    time.Duration
+	percent float64
+	line    int
+}
+
+// Parse parses a time expression. Supported expressions are:
+//
+//   - 1:23, 1:02:03, 20 (seconds) or Go durations like 1m20s
+//   - 50% of track length
+//   - line:12 for a lyrics line, negative numbers count from the last line
+//   - +2lines or -1line relative to current lyrics line
+//   - next-chorus for the start of next repeated part of lyrics
+//   - start-of-line for the start of current lyrics line
+//
+// Times and percentages can have + or - sign.
+func Parse(s string) (Expr, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	switch s {
+	case "next-chorus":
+		return Expr{kind: kindChorus}, nil
+	case "start-of-line":
+		return Expr{kind: kindLineStart}, nil
+	}
+
+	if n, ok := strings.CutPrefix(s, "line:"); ok {
+		line, err := strconv.Atoi(n)
+		if err != nil {
+			return Expr{}, fmt.Errorf("invalid line number %q: %w", n, err)
+		}
+		return Expr{kind: kindLine, line: line}, nil
+	}
+
+	var e Expr
+	if rest, ok := strings.CutPrefix(s, "+"); ok {
+		e.sign, s = 1, rest
+	} else if rest, ok := strings.CutPrefix(s, "-"); ok {
+		e.sign, s = -1, rest
+	}
+
+	for suffix := range slices.Values([]string{"lines", "line"}) {
+		n, ok := strings.CutSuffix(s, suffix)
+		if !ok {
+			continue
+		}
+		lines, err := strconv.Atoi(n)
+		if err != nil || lines < 0 {
+			return Expr{}, fmt.Errorf("invalid number of lines %q", n)
+		}
+		e.kind, e.line = kindLines, lines
+		return e, nil
+	}
+
+	if n, ok := strings.CutSuffix(s, "%"); ok {
+		p, err := strconv.ParseFloat(n, 64)
+		if err != nil || p < 0 || p > 100 {
+			return Expr{}, fmt.Errorf("invalid percentage %q", n)
+		}
+		e.kind, e.percent = kindPercent, p/100
+		return e, nil
+	}
+
+	var err error
+	if _, numErr := strconv.ParseFloat(s, 64); numErr == nil || strings.Contains(s, ":") {
+		e.time, err = lyric.ParseTimestamp(s)
+	} else {
+		e.time, err = time.ParseDuration(s)
+	}
+	if err != nil || e.time < 0 {
+		return Expr{}, fmt.Errorf("invalid time %q", s)
+	}
+	e.kind = kindTime
+	return e, nil
+}
+
+// NeedsLyrics reports whether lyrics are required to resolve the expression
+func (e Expr) NeedsLyrics() bool {
+	return e.kind >= kindLine
+}
+
+// Offset returns the offset from current position if the expression is a
+// plain time, e.g. 10s or -5s
+func (e Expr) Offset() (time.Duration, bool) {
+	if e.kind != kindTime {
+		return 0, false
+	}
+	if e.sign < 0 {
+		return -e.time, true
+	}
+	return e.time, true
+}
+
+// Context is the player state an expression is resolved against. Position
+// and resolved positions are corrected by the latency of the player, the same
+// way lyrics are timed. Length is the track length reported by the player.
+type Context struct {
+	Position time.Duration
+	Length   time.Duration
+	Lyrics   shared.Lyrics
+
+	// info converts positions of the player, nil when positions aren't
+	// corrected
+	info *player.Info
+}
+
+// Load reads the context from the player. Lyrics are fetched only when
+// withLyrics is set. Without lyrics, the context of players which can't be
+// parsed is in player time.
+func Load(mp *mpris.Player, parser player.Parser, withLyrics bool) (Context, error) {
+	info, err := parser(mp)
+	if err == nil {
+		return ForInfo(info, withLyrics)
+	}
+	if withLyrics {
+		return Context{}, fmt.Errorf("failed to parse player informations: %w", err)
+	}
+
+	pos, err := mp.GetPosition()
+	if err != nil {
+		return Context{}, fmt.Errorf("failed to get player position: %w", err)
+	}
+	length, _ := mp.GetLength() // Only required by some expressions
+	return Context{Position: pos, Length: length}, nil
+}
+
+// ForInfo returns the context of parsed player information. Lyrics are
+// fetched only when withLyrics is set.
+func ForInfo(info *player.Info, withLyrics bool) (Context, error) {
+	c := Context{Position: info.Position, Length: info.Length, info: info}
+	if !withLyrics {
+		return c, nil
+	}
+
+	lyrics, err := lyric.GetLyrics(info)
+	if err != nil {
+		return Context{}, fmt.Errorf("failed to fetch lyrics: %w", err)
+	}
+	c.Lyrics = lyrics
+	return c, nil
+}
+
+// PlayerPosition converts a resolved position to the position of the player,
+// e.g. to seek the player
+func (c Context) PlayerPosition(pos time.Duration) time.Duration {
+	if c.info == nil {
+		return pos
+	}
+	return c.info.PlayerPosition(pos)
+}
+
+// lyricPosition converts a position of the player, e.g. a time expression, to
+// a corrected position
+func (c Context) lyricPosition(pos time.Duration) time.Duration {
+	if c.info == nil {
+		return pos
+	}
+	return c.info.LyricPosition(pos)
+}
+
+// Position resolves the expression to a position. Times and percentages are
+// from the start of the track, or from the end with - sign.
+func (e Expr) Position(c Context) (time.Duration, error) {
+	return e.resolve(c, false)
+}
+
+// Seek resolves the expression to a position. Times and percentages are
+// offsets from current position.
+func (e Expr) Seek(c Context) (time.Duration, error) {
+	return e.resolve(c, true)
+}
+
+// End resolves the expression like Position, but lyrics lines resolve to the
+// end of the line
+func (e Expr) End(c Context) (time.Duration, error) {
+	if !e.NeedsLyrics() {
+		return e.Position(c)
+	}
+
+	idx, err := e.index(c)
+	if err != nil {
+		return 0, err
+	}
+	if idx+1 < len(c.Lyrics) {
+		return c.Lyrics[idx+1].Timestamp, nil
+	}
+	if c.Length <= 0 {
+		return 0, ErrNoLength
+	}
+	return c.lyricPosition(c.Length), nil
+}
+
+func (e Expr) resolve(c Context, relative bool) (time.Duration, error) {
+	if e.NeedsLyrics() {
+		idx, err := e.index(c)
+		if err != nil {
+			return 0, err
+		}
+		return c.Lyrics[idx].Timestamp, nil
+	}
+
+	switch e.kind {
+	case kindTime, kindPercent:
+		d := e.time
+		if e.kind == kindPercent {
+			if c.Length <= 0 {
+				return 0, ErrNoLength
+			}
+			d = time.Duration(float64(c.Length) * e.percent)
+		}
+
+		// Times and percentages from the start or the end are positions of
+		// the player
+		var pos time.Duration
+		switch {
+		case relative && e.sign < 0:
+			pos = c.Position - d
+		case relative:
+			pos = c.Position + d
+		case e.sign < 0:
+			if c.Length <= 0 {
+				return 0, ErrNoLength
+			}
+			pos = c.lyricPosition(c.Length - d)
+		default:
+			pos = c.lyricPosition(d)
+		}
+
+		pos = max(pos, c.lyricPosition(0))
+		if c.Length > 0 {
+			pos = min(pos, c.lyricPosition(c.Length))
+		}
+		return pos, nil
+	}
+	return 0, fmt.Errorf("unknown expression kind %d", e.kind)
+}
+
+// index resolves the lyrics line of the expression
+func (e Expr) index(c Context) (int, error) {
+	switch e.kind {
+	case kindLine:
+		idx := e.line
+		if idx < 0 {
+			idx += len(c.Lyrics)
+		}
+		return c.line(idx)
+	case kindLines:
+		if e.sign < 0 {
+			return c.line(c.current() - e.line)
+		}
+		return c.line(c.current() + e.line)
+	case kindLineStart:
+		return c.line(c.current())
+	case kindChorus:
+		current := c.current()
+		for idx := range slices.Values(choruses(c.Lyrics)) {
+			if idx > current {
+				return idx, nil
+			}
+		}
+		return 0, ErrNoChorus
+	}
+	return 0, fmt.Errorf("expression kind %d is not a lyrics line", e.kind)
+}
+
+// current returns the index of current lyrics line
+func (c Context) current() int {
+	var idx int
+	for i, line := range c.Lyrics {
+		if c.Position <= line.Timestamp {
+			break
+		}
+		idx = i
+	}
+	return idx
+}
+
+// line checks if the lyrics line at idx exists. The first line is the empty
+// line at the start of the lyrics.
+func (c Context) line(idx int) (int, error) {
+	if idx < 0 || idx >= len(c.Lyrics) {
+		return 0, fmt.Errorf("%w (line-count=%d, requested=%d)", ErrOutOfRange, max(len(c.Lyrics)-1, 0), idx)
+	}
+	return idx, nil
+}
@@ -0,0 +1,219 @@
+package timeexpr
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Nadim147c/waybar-lyric/internal/player"
+	"github.com/Nadim147c/waybar-lyric/internal/shared"
+)
+
+func lyricsOf(lines ...string) shared.Lyrics {
+	lyrics := shared.Lyrics{{}}
+	for i, line := range lines {
+		lyrics = append(lyrics, shared.LyricLine{Timestamp: time.Duration(i+1) * 10 * time.Second, Text: line})
+	}
+	return lyrics
+}
+
+func TestResolve(t *testing.T) {
+	c := Context{
+		Position: 25 * time.Second,
+		Length:   100 * time.Second,
+		Lyrics:   lyricsOf("a", "b", "c", "d"), // 10s, 20s, 30s, 40s
+	}
+
+	tests := []struct {
+		expr     string
+		position time.Duration
+		seek     time.Duration
+	}{
+		{"1:23", 83 * time.Second, 100 * time.Second}, // clamped to length
+		{"20", 20 * time.Second, 45 * time.Second},
+		{"-10s", 90 * time.Second, 15 * time.Second},
+		{"1m30s", 90 * time.Second, 100 * time.Second},
+		{"50%", 50 * time.Second, 75 * time.Second},
+		{"-10%", 90 * time.Second, 15 * time.Second},
+		{"line:1", 10 * time.Second, 10 * time.Second},
+		{"line:-1", 40 * time.Second, 40 * time.Second},
+		{"+1line", 30 * time.Second, 30 * time.Second},
+		{"2lines", 40 * time.Second, 40 * time.Second},
+		{"-2lines", 0, 0},
+		{"start-of-line", 20 * time.Second, 20 * time.Second},
+	}
+
+	for _, tt := range tests {
+		e, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got, err := e.Position(c); err != nil || got != tt.position {
+			t.Errorf("Parse(%q).Position() = %v, %v, want %v", tt.expr, got, err, tt.position)
+		}
+		if got, err := e.Seek(c); err != nil || got != tt.seek {
+			t.Errorf("Parse(%q).Seek() = %v, %v, want %v", tt.expr, got, err, tt.seek)
+		}
+	}
+}
+
+func TestEnd(t *testing.T) {
+	c := Context{
+		Position: 25 * time.Second,
+		Length:   100 * time.Second,
+		Lyrics:   lyricsOf("a", "b", "c", "d"), // 10s, 20s, 30s, 40s
+	}
+
+	tests := []struct {
+		expr string
+		want time.Duration
+	}{
+		{"start-of-line", 30 * time.Second},
+		{"line:3", 40 * time.Second},
+		{"line:-1", 100 * time.Second}, // last line ends with the track
+		{"1:05", 65 * time.Second},
+	}
+
+	for _, tt := range tests {
+		e, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if got, err := e.End(c); err != nil || got != tt.want {
+			t.Errorf("Parse(%q).End() = %v, %v, want %v", tt.expr, got, err, tt.want)
+		}
+	}
+}
+
+func TestResolveOutOfRange(t *testing.T) {
+	c := Context{Position: 25 * time.Second, Lyrics: lyricsOf("a", "b", "c", "d")}
+
+	// line:5 used to index past the end of the lyrics
+	for expr := range slices.Values([]string{"line:5", "line:-6", "+3lines", "-3lines"}) {
+		e, err := Parse(expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", expr, err)
+		}
+		if _, err := e.Position(c); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("Parse(%q).Position() error = %v, want ErrOutOfRange", expr, err)
+		}
+	}
+
+	e, _ := Parse("50%")
+	if _, err := e.Position(c); !errors.Is(err, ErrNoLength) {
+		t.Errorf("Position() of percentage without length error = %v, want ErrNoLength", err)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for expr := range slices.Values([]string{"", "abc", "line:x", "+xlines", "150%", "1:2:3:4", "--5s"}) {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
+
+func TestChorus(t *testing.T) {
+	lyrics := lyricsOf(
+		"Verse one", "Verse two",
+		"Hold on, hold on", "Don't let go",
+		"Verse three", "Verse four",
+		"Hold on hold on", "don't let go!",
+	)
+
+	if got, want := choruses(lyrics), []int{3, 7}; !slices.Equal(got, want) {
+		t.Errorf("choruses() = %v, want %v", got, want)
+	}
+
+	e, _ := Parse("next-chorus")
+	c := Context{Position: 35 * time.Second, Lyrics: lyrics}
+	if got, err := e.Seek(c); err != nil || got != 70*time.Second {
+		t.Errorf("next-chorus = %v, %v, want 70s", got, err)
+	}
+
+	c.Position = 75 * time.Second
+	if _, err := e.Seek(c); !errors.Is(err, ErrNoChorus) {
+		t.Errorf("next-chorus after last chorus error = %v, want ErrNoChorus", err)
+	}
+}
+
+func TestResolveLatency(t *testing.T) {
+	// Lyrics are heard 500ms after the player reports them
+	info := &player.Info{
+		Length:  100 * time.Second,
+		Rate:    1,
+		Latency: player.Latency{Offset: -500 * time.Millisecond},
+	}
+	info.SetPosition(25 * time.Second)
+
+	c, err := ForInfo(info, false)
+	if err != nil {
+		t.Fatalf("ForInfo() failed: %v", err)
+	}
+	c.Lyrics = lyricsOf("a", "b", "c", "d") // 10s, 20s, 30s, 40s
+
+	tests := []struct {
+		expr     string
+		position time.Duration
+		seek     time.Duration
+	}{
+		{"1:23", 83 * time.Second, 100 * time.Second},
+		{"-10s", 90 * time.Second, 15 * time.Second},
+		{"50%", 50 * time.Second, 75 * time.Second},
+		{"line:1", 10500 * time.Millisecond, 10500 * time.Millisecond},
+		{"+1line", 30500 * time.Millisecond, 30500 * time.Millisecond},
+		{"start-of-line", 20500 * time.Millisecond, 20500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		e, err := Parse(tt.expr)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.expr, err)
+			continue
+		}
+		if got, err := e.Position(c); err != nil || c.PlayerPosition(got) != tt.position {
+			t.Errorf("Parse(%q).Position() = %v, %v, want player position %v", tt.expr, c.PlayerPosition(got), err, tt.position)
+		}
+		if got, err := e.Seek(c); err != nil || c.PlayerPosition(got) != tt.seek {
+			t.Errorf("Parse(%q).Seek() = %v, %v, want player position %v", tt.expr, c.PlayerPosition(got), err, tt.seek)
+		}
+	}
+}
+
+func TestEndLatency(t *testing.T) {
+	// Loop bounds are compared with the corrected position of the player
+	info := &player.Info{
+		Length:  100 * time.Second,
+		Rate:    1,
+		Latency: player.Latency{Offset: -500 * time.Millisecond},
+	}
+	info.SetPosition(25 * time.Second)
+
+	c, err := ForInfo(info, false)
+	if err != nil {
+		t.Fatalf("ForInfo() failed: %v", err)
+	}
+	c.Lyrics = lyricsOf("a", "b", "c", "d") // 10s, 20s, 30s, 40s
+
+	tests := []struct {
+		expr string
+		want time.Duration
+	}{
+		{"1:05", 64500 * time.Millisecond},
+		{"50%", 49500 * time.Millisecond},
+		{"line:3", 40 * time.Second},
+		{"line:-1", 99500 * time.Millisecond}, // last line ends with the track
+	}
+
+	for _, tt := range tests {
+		e, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if got, err := e.End(c); err != nil || got != tt.want {
+			t.Errorf("Parse(%q).End() = %v, %v, want %v", tt.expr, got, err, tt.want)
+		}
+	}
+}
@@ -3,10 +3,11 @@ package waybar
 import (
 	"encoding/json"
 	"fmt"
-	"os"
 	"slices"
 	"strings"
+	"time"
 
+	"github.com/Nadim147c/go-mpris"
 	"github.com/Nadim147c/waybar-lyric/internal/config"
 	"github.com/Nadim147c/waybar-lyric/internal/player"
 	"github.com/Nadim147c/waybar-lyric/internal/shared"
@@ -86,20 +87,58 @@ func ForLyrics(lyrics shared.Lyrics, idx int) *Waybar {
 	return waybar
 }
 
+// ForPosition returns Waybar for the lyrics line at the player position and
+// index of the line. Artist and title are shown while paused and before the
+// first line.
+func ForPosition(info *player.Info, lyrics shared.Lyrics) (*Waybar, int) {
+	var idx int
+	for i, line := range lyrics {
+		if info.Position <= line.Timestamp {
+			break
+		}
+		idx = i
+	}
+
+	w := ForLyrics(lyrics, idx)
+	if config.Detailed {
+		w.Info = info
+	}
+	w.Percentage = info.Percentage()
+
+	switch {
+	case info.Status == mpris.PlaybackPaused:
+		w.Paused(info)
+	case lyrics[idx].Text == "":
+		w.Text = fmt.Sprintf("%s - %s", info.Artist, info.Title)
+		w.Alt = Music
+	}
+	return w, idx
+}
+
 // Zero is a empty Waybar
 var Zero = &Waybar{}
 
+// DisconnectedWaybar is Waybar shown while dbus session bus is not connected
+var DisconnectedWaybar = &Waybar{
+	Text:    "Disconnected",
+	Class:   Class{Disconnected},
+	Alt:     Disconnected,
+	Tooltip: "Reconnecting to dbus session bus",
+}
+
 // Status is the alt/class for waybar
 type Status string
 
 const (
 	//revive:disable
-	Music   Status = "music"
-	Lyric   Status = "lyric"
-	Playing Status = "playing"
-	Paused  Status = "paused"
-	NoLyric Status = "no_lyric"
-	Getting Status = "getting"
+	Music        Status = "music"
+	Lyric        Status = "lyric"
+	Playing      Status = "playing"
+	Paused       Status = "paused"
+	NoLyric      Status = "no_lyric"
+	Getting      Status = "getting"
+	Disconnected Status = "disconnected"
+	Sleep        Status = "sleep"
 	//revive:enable
 )
 
@@ -113,40 +152,56 @@ type Waybar struct {
 	Alt        Status         `json:"alt"`
 	Tooltip    string         `json:"tooltip"`
 	Percentage int            `json:"percentage"`
+	Sleep      int            `json:"sleep,omitempty"`
 	Info       *player.Info   `json:"info,omitempty"`
 	Context    *shared.Lyrics `json:"context,omitempty"`
 }
 
-// JSON is the json encoder for waybar
-var JSON = json.NewEncoder(os.Stdout)
-
-func init() {
-	JSON.SetEscapeHTML(false)
-}
+// Hook is called with every printed Waybar and the printed line, e.g. to
+// record the output
+var Hook func(w *Waybar, line string)
 
 var lastLine string
 
 // Encode prints the Waybar as json to Stdout
 func (w *Waybar) Encode() {
-	if config.LyricOnly && (w.Alt == Paused || w.Alt == Music) {
-		fmt.Println("")
+	line, ok := w.line()
+	if !ok {
 		return
 	}
 
+	fmt.Println(line)
+	if Hook != nil {
+		Hook(w, line)
+	}
+}
+
+// line returns the line printed for the Waybar. It returns false if nothing
+// should be printed.
+func (w *Waybar) line() (string, bool) {
+	if config.LyricOnly && (w.Alt == Paused || w.Alt == Music) {
+		return "", true
+	}
+
 	if config.Compact {
-		if lastLine != w.Text {
-			fmt.Println(w.Text)
-			lastLine = w.Text
+		if lastLine == w.Text {
+			return "", false
 		}
-		return
+		lastLine = w.Text
+		return w.Text, true
 	}
 
 	if w == Zero {
-		fmt.Println("{}")
-		return
+		return "{}", true
 	}
 
-	JSON.Encode(w)
+	var line strings.Builder
+	enc := json.NewEncoder(&line)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(w); err != nil {
+		return "", false
+	}
+	return strings.TrimSuffix(line.String(), "\n"), true
 }
 
 // Is indecates if current Waybar is equal to another Waybar
@@ -160,7 +215,8 @@ func (w *Waybar) Is(other *Waybar) bool {
 	if w.Text != other.Text ||
 		w.Alt != other.Alt ||
 		w.Tooltip != other.Tooltip ||
-		w.Percentage != other.Percentage {
+		w.Percentage != other.Percentage ||
+		w.Sleep != other.Sleep {
 		return false
 	}
 
@@ -202,3 +258,22 @@ func (w *Waybar) Paused(info *player.Info) {
 	w.Alt = Paused
 	w.Class = Class{Paused}
 }
+
+// SleepTimer adds the sleep timer to class and tooltip. Sleep is set to
+// seconds until the player is paused. left is negative when it's not known
+// yet, e.g. before the last track of a track timer.
+func (w *Waybar) SleepTimer(tracks int, left time.Duration) {
+	w.Class = append(w.Class, Sleep)
+
+	status := fmt.Sprintf("Sleep timer: %d tracks left", tracks)
+	if left >= 0 {
+		left = left.Round(time.Second)
+		w.Sleep = int(left.Seconds())
+		status = fmt.Sprintf("Sleep timer: %d:%02d left", int(left.Minutes()), int(left.Seconds())%60)
+	}
+
+	if w.Tooltip != "" {
+		w.Tooltip += "\n\n"
+	}
+	w.Tooltip += status
+}